@@ -6,7 +6,9 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/prashantv/autobld/log"
@@ -21,12 +23,59 @@ var defaultExcludeDirMap = map[string]bool{".git": true, ".hg": true}
 const (
 	defaultChangeTimeout = time.Second
 	defaultKillTimeout   = time.Second
+	defaultPortTimeout   = 5 * time.Second
+	defaultCheckTimeout  = 10 * time.Minute
+	defaultStartGrace    = 2 * time.Second
 )
 
 // Config is the struct defining the config file passed in to the file watcher.
 type Config struct {
+	// Task is used when there is a single task configured at the top level.
+	// When Tasks is specified, the top-level BaseDir and timeouts are used as defaults.
+	Task `yaml:",inline"`
+
+	// Tasks is the map of named tasks to run. Each task has its own state machine.
+	// Once the config is parsed, Tasks contains all the tasks, including the top-level task.
+	Tasks map[string]*Task `yaml:"tasks"`
+
+	// Check is run once all tasks are ready when using --once. autobld exits
+	// with the check's exit code.
+	Check *Step `yaml:"check"`
+
+	// CheckTimeout is how long the check can run before it is stopped and fails.
+	CheckTimeout time.Duration `yaml:"checkTimeout"`
+
+	// StartGrace is how long a server without a readiness probe must keep running
+	// when using --once before it is treated as ready.
+	StartGrace time.Duration `yaml:"startGrace"`
+
+	// Once is set by the --once flag to start the tasks, wait for them to be ready,
+	// run Check, and then exit without watching for changes.
+	Once bool `yaml:"-"`
+
+	// Interactive configures keyboard commands, such as restarting the tasks.
+	Interactive Interactive `yaml:"interactive"`
+
+	// Init reaps zombie processes, restarts the tasks on SIGHUP and logs their status on
+	// SIGQUIT, for running as the init process of a container. It is enabled automatically
+	// when autobld runs as PID 1.
+	Init bool `yaml:"init"`
+
+	// ForwardSignals are the signals that are sent to the running tasks when autobld receives them.
+	ForwardSignals []Signal `yaml:"forwardSignals"`
+
+	// order is the task names sorted so that dependencies are before their dependents.
+	order []string
+}
+
+// Task is the configuration for a single task and the files it watches.
+type Task struct {
+	// Name is the name of the task. It is empty for a top-level task.
+	Name string `yaml:"-"`
+
 	// BaseDir is the base directory where configs are based.
 	// If this is not specified, the config file's location is used by default.
+	// For named tasks, a relative BaseDir is relative to the top-level BaseDir.
 	BaseDir string `yaml:"baseDir"`
 
 	// Matchers is the list of configurations to match.
@@ -37,19 +86,87 @@ type Config struct {
 	ProxyConfigs []proxy.Config `yaml:"proxy"`
 
 	// Action is the command to run to compile + restart the server.
+	// It is shorthand for a single step, and cannot be used with Steps.
 	Action []string `yaml:"action"`
 
+	// Shell is an alternative to Action, which is a command run using the system shell.
+	Shell string `yaml:"shell"`
+
+	// Steps is the list of commands to run in order. Each step must succeed before
+	// the next step is run, and the last step is the long-running server.
+	Steps []Step `yaml:"steps"`
+
+	// DependsOn is the list of tasks that must be ready before this task is started.
+	// The task is restarted whenever any of its dependencies restart.
+	DependsOn []string `yaml:"dependsOn"`
+
+	// BuildBeforeSwap keeps the previous server running while the build steps run,
+	// and only replaces it once the build succeeds.
+	BuildBeforeSwap bool `yaml:"buildBeforeSwap"`
+
+	// Mode is either ModeServer (default), where the last step is a long-running
+	// server, or ModeOneshot, where every run is expected to run to completion.
+	Mode string `yaml:"mode"`
+
 	// StdOut is the file that the task's STDOUT is written to.
 	StdOut string `yaml:"outFile"`
 
 	// StdErr is the file that the task's STDERR is written to.
 	StdErr string `yaml:"errFile"`
 
+	// Output configures how the output files are written.
+	Output Output `yaml:"output"`
+
+	// TTY runs the task under a pseudo-terminal, with STDOUT and STDERR combined.
+	TTY bool `yaml:"tty"`
+
 	// Timeout configurations
 	ChangeTimeout time.Duration `yaml:"changeTimeout"`
 	KillTimeout   time.Duration `yaml:"killTimeout"`
+	PortTimeout   time.Duration `yaml:"portTimeout"`
+	DrainTimeout  time.Duration `yaml:"drainTimeout"`
+
+	// StopSignals is the sequence of signals used to stop the task. Each signal is
+	// sent if the task has not exited within the previous signal's timeout.
+	// By default, SIGINT is sent, followed by SIGKILL after KillTimeout.
+	StopSignals []StopSignal `yaml:"stopSignals"`
+
+	// Env is the environment variables set for the task, which can refer to other
+	// variables using ${VAR}.
+	Env map[string]string `yaml:"env"`
+
+	// EnvFiles are files in dotenv format that contain environment variables for the task.
+	// Relative paths are relative to baseDir. The task is reloaded when an env file changes.
+	EnvFiles []string `yaml:"envFiles"`
+
+	// Restart is the policy for restarting the task if it exits on its own.
+	Restart Restart `yaml:"restart"`
+
+	// Ready is the readiness probe used to decide when the task has started.
+	// Proxies block till the probe succeeds. If it is not set, the task is
+	// ready as soon as it is started.
+	Ready *Probe `yaml:"ready"`
+
+	// Diagnostics enables parsing compiler errors and other diagnostics from the
+	// task's STDERR, which are summarized when each step exits.
+	Diagnostics *Diagnostics `yaml:"diagnostics"`
+
+	// Hooks are commands that are run at points in the task's lifecycle, such as
+	// before the task starts or when it crashes.
+	Hooks Hooks `yaml:"hooks"`
+
+	configsMap map[string][]*Matcher
+}
 
-	configsMap map[string]*Matcher
+// Step is a single named command that is run as part of the task.
+type Step struct {
+	// Name is used to identify the step in logs. Defaults to the command name, or
+	// defaultShellStepName for a shell command.
+	Name string `yaml:"name"`
+	// Action is the command and arguments to run.
+	Action []string `yaml:"action"`
+	// Shell is an alternative to Action, which is a command run using the system shell.
+	Shell string `yaml:"shell"`
 }
 
 // Matcher represents a specific set of patterns for some directories.
@@ -61,9 +178,34 @@ type Matcher struct {
 	// By default, everything in defaultExcludeDirMap is excluded.
 	ExcludeDirs []string `yaml:"excludeDirs"`
 
+	// OnChange is the action taken when a matching file changes: OnChangeRestart (default)
+	// restarts the task, while OnChangeSignal sends Signal to the running task.
+	OnChange string `yaml:"onChange"`
+	// Signal is the signal sent for OnChangeSignal. The default is SIGHUP.
+	Signal Signal `yaml:"signal"`
+
+	// noRecurse is set if only the matcher's dirs are watched, and not their subdirectories.
+	noRecurse bool
+
+	// Run is a command that is run in baseDir when a matching file changes, before the
+	// task is restarted. It is used for code generation, e.g. running protoc.
+	Run []string `yaml:"run"`
+
 	excludeDirMap map[string]bool
 }
 
+// List of actions that can be taken by a Matcher when a file changes.
+const (
+	OnChangeRestart = "restart"
+	OnChangeSignal  = "signal"
+)
+
+// List of modes for a task.
+const (
+	ModeServer  = "server"
+	ModeOneshot = "oneshot"
+)
+
 // opts are the command-line flags parsed by go-flags.
 type opts struct {
 	Verbose []bool `long:"verbose" short:"v" description:"Verbose logging"`
@@ -78,6 +220,17 @@ type opts struct {
 	Proxies     []string `long:"proxy" short:"p" description:"Proxy ports, specified as [protocol]:[sourcePort]:[targetPort]/[targetBaseDir]"`
 	OutFile     string   `long:"outFile" short:"o" description:"File to redirect task's STDOUT to."`
 	ErrFile     string   `long:"errFile" description:"File to redirect task's STDERR to."`
+	Tee         bool     `long:"tee" description:"Write the task's output to the terminal as well as outFile and errFile"`
+	Append      bool     `long:"append" description:"Append to outFile and errFile instead of truncating them"`
+	Env         []string `long:"env" short:"e" description:"Environment variables for the task, specified as KEY=VALUE"`
+	Shell       bool     `long:"shell" short:"s" description:"Run the action and arguments as a single shell command"`
+	TTY         bool     `long:"tty" short:"t" description:"Run the task under a pseudo-terminal"`
+	Oneshot     bool     `long:"oneshot" description:"Run the task to completion on every change, and report whether it passed"`
+	Once        bool     `long:"once" description:"Start the tasks, wait till they are ready, run the check command and exit"`
+	Check       string   `long:"check" description:"Shell command to run with --once once the tasks are ready"`
+	Interactive bool     `long:"interactive" short:"i" description:"Enable keyboard commands, typed after Ctrl-T"`
+	Init        bool     `long:"init" description:"Reap zombie processes and handle SIGHUP and SIGQUIT, as the init process of a container"`
+	Forward     []string `long:"forwardSignal" description:"Signals that are forwarded to the tasks"`
 	Args        struct {
 		Action []string `positional-arg-name:"Action and arguments" description:"Action and arguments to run"`
 	} `positional-args:"yes" required:"yes"`
@@ -85,6 +238,13 @@ type opts struct {
 	// Timeout configurations
 	ChangeTimeout time.Duration `long:"changeTimeout" description:"Time to wait after a change is detected before reloading the task"`
 	KillTimeout   time.Duration `long:"killTimeout" description:"Time to wait after Ctrl-C before killing the task"`
+	PortTimeout   time.Duration `long:"portTimeout" description:"Time to wait for the forwardTo ports to be released before starting the task"`
+	DrainTimeout  time.Duration `long:"drainTimeout" description:"Time to wait for proxied HTTP requests to finish before stopping the task"`
+	StopSignals   []string      `long:"stopSignal" description:"Signals used to stop the task, specified as [signal]:[timeout]"`
+	CheckTimeout  time.Duration `long:"checkTimeout" description:"Time the check can run with --once before it is stopped and fails"`
+	StartGrace    time.Duration `long:"startGrace" description:"Time a server without a readiness probe must run with --once before it is ready"`
+
+	Restart string `long:"restart" description:"Restart policy if the task exits: never, on-failure or always"`
 }
 
 // Parse returns a configuration from either a configuration file or flags.
@@ -103,15 +263,200 @@ func Parse() (*Config, error) {
 	} else {
 		log.SetLevel(len(opts.Verbose))
 	}
+
+	var c *Config
+	var err error
 	if opts.ConfigPath == "" {
-		return parseArgs(opts)
+		c, err = parseArgs(opts)
+	} else {
+		c, err = parseFile(opts.ConfigPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c.Once = opts.Once
+	if opts.Check != "" {
+		c.Check = &Step{Shell: opts.Check}
+	}
+	if c.Check != nil {
+		if err := normalizeStep(c.Check); err != nil {
+			return nil, fmt.Errorf("check %v", err)
+		}
+	}
+	if opts.CheckTimeout != 0 {
+		c.CheckTimeout = opts.CheckTimeout
+	}
+	if c.CheckTimeout == 0 {
+		c.CheckTimeout = defaultCheckTimeout
+	}
+	if opts.StartGrace != 0 {
+		c.StartGrace = opts.StartGrace
+	}
+	if c.StartGrace == 0 {
+		c.StartGrace = defaultStartGrace
+	}
+
+	if opts.Interactive {
+		c.Interactive.Enabled = true
 	}
-	return parseFile(opts.ConfigPath)
+	if err := normalizeInteractive(&c.Interactive); err != nil {
+		return nil, fmt.Errorf("interactive: %v", err)
+	}
+
+	if opts.Init || os.Getpid() == 1 {
+		c.Init = true
+	}
+	for _, s := range argPatterns(opts.Forward) {
+		sig, err := ParseSignal(s)
+		if err != nil {
+			return nil, err
+		}
+		c.ForwardSignals = append(c.ForwardSignals, sig)
+	}
+	if err := checkForwardSignals(c.ForwardSignals); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// checkTopLevel returns an error if any top-level task fields other than baseDir and
+// the timeouts are set when tasks are used, as they would be ignored.
+func checkTopLevel(t *Task) error {
+	fields := []struct {
+		name string
+		set  bool
+	}{
+		{"matchers", len(t.Matchers) > 0},
+		{"proxy", len(t.ProxyConfigs) > 0},
+		{"action", len(t.Action) > 0},
+		{"shell", t.Shell != ""},
+		{"steps", len(t.Steps) > 0},
+		{"dependsOn", len(t.DependsOn) > 0},
+		{"buildBeforeSwap", t.BuildBeforeSwap},
+		{"mode", t.Mode != ""},
+		{"outFile", t.StdOut != ""},
+		{"errFile", t.StdErr != ""},
+		{"output", t.Output != Output{}},
+		{"tty", t.TTY},
+		{"stopSignals", len(t.StopSignals) > 0},
+		{"env", len(t.Env) > 0},
+		{"envFiles", len(t.EnvFiles) > 0},
+		{"restart", t.Restart != Restart{}},
+		{"ready", t.Ready != nil},
+		{"diagnostics", t.Diagnostics != nil},
+		{"hooks", t.Hooks != Hooks{}},
+	}
+	var set []string
+	for _, f := range fields {
+		if f.set {
+			set = append(set, f.name)
+		}
+	}
+	if len(set) > 0 {
+		return fmt.Errorf("top-level %v cannot be used with tasks, they must be set for each task", strings.Join(set, ", "))
+	}
+	return nil
 }
 
 func normalize(config *Config) (*Config, error) {
-	if len(config.Action) == 0 {
-		return nil, errors.New("no action specified, please specify an action")
+	if len(config.Tasks) == 0 {
+		config.Tasks = map[string]*Task{"": &config.Task}
+	} else if err := checkTopLevel(&config.Task); err != nil {
+		return nil, err
+	}
+
+	proxyPorts := make(map[int]string)
+	for _, name := range sortedNames(config.Tasks) {
+		t := config.Tasks[name]
+		if t == nil {
+			return nil, fmt.Errorf("task %v has no configuration", name)
+		}
+		t.Name = name
+		if t != &config.Task {
+			if !filepath.IsAbs(t.BaseDir) {
+				t.BaseDir = filepath.Join(config.BaseDir, t.BaseDir)
+			}
+			if t.ChangeTimeout == 0 {
+				t.ChangeTimeout = config.ChangeTimeout
+			}
+			if t.KillTimeout == 0 {
+				t.KillTimeout = config.KillTimeout
+			}
+			if t.PortTimeout == 0 {
+				t.PortTimeout = config.PortTimeout
+			}
+			if t.DrainTimeout == 0 {
+				t.DrainTimeout = config.DrainTimeout
+			}
+		}
+		if err := normalizeTask(t); err != nil {
+			if name != "" {
+				return nil, fmt.Errorf("task %v: %v", name, err)
+			}
+			return nil, err
+		}
+		for _, pc := range t.ProxyConfigs {
+			if other, ok := proxyPorts[pc.Port]; ok {
+				return nil, fmt.Errorf("proxy port %v is used by tasks %v and %v", pc.Port, other, name)
+			}
+			proxyPorts[pc.Port] = name
+		}
+	}
+
+	var err error
+	if config.order, err = sortTasks(config.Tasks); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// UsesTTY returns whether any task runs under a pseudo-terminal.
+func (c *Config) UsesTTY() bool {
+	for _, t := range c.Tasks {
+		if t.TTY {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckStopSignals returns the signals used to stop the check, which are the same as the
+// top-level task's stop signals.
+func (c *Config) CheckStopSignals() []StopSignal {
+	if len(c.StopSignals) > 0 {
+		return c.StopSignals
+	}
+	killTimeout := c.KillTimeout
+	if killTimeout == 0 {
+		killTimeout = defaultKillTimeout
+	}
+	return normalizeStopSignals(nil, killTimeout)
+}
+
+// TaskNames returns the names of all the tasks, with each task after all of its dependencies.
+// Tasks should be started in this order, and stopped in the reverse order.
+func (c *Config) TaskNames() []string {
+	return c.order
+}
+
+func normalizeTask(config *Task) error {
+	if len(config.Action) > 0 || config.Shell != "" {
+		if len(config.Steps) > 0 {
+			return errors.New("action and steps cannot both be specified")
+		}
+		config.Steps = []Step{{Action: config.Action, Shell: config.Shell}}
+	}
+	if len(config.Steps) == 0 {
+		return errors.New("no action specified, please specify an action")
+	}
+	if config.TTY && runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		return errors.New("tty is only supported on Linux and macOS")
+	}
+	for i := range config.Steps {
+		if err := normalizeStep(&config.Steps[i]); err != nil {
+			return fmt.Errorf("step %v %v", i+1, err)
+		}
 	}
 
 	// Set up a default dir config to listen for everything.
@@ -120,9 +465,25 @@ func normalize(config *Config) (*Config, error) {
 			Patterns: []string{"*"},
 		}}
 	}
-	config.configsMap = make(map[string]*Matcher)
+	if err := normalizeEnvFiles(config); err != nil {
+		return err
+	}
+	config.configsMap = make(map[string][]*Matcher)
 
 	for i := range config.Matchers {
+		switch m := &config.Matchers[i]; m.OnChange {
+		case "", OnChangeRestart:
+			m.OnChange = OnChangeRestart
+		case OnChangeSignal:
+			if len(m.Run) > 0 {
+				return errors.New("run cannot be used with onChange: signal")
+			}
+			if m.Signal == 0 {
+				m.Signal = Signal(syscall.SIGHUP)
+			}
+		default:
+			return fmt.Errorf("unknown onChange %q, must be %v or %v", m.OnChange, OnChangeRestart, OnChangeSignal)
+		}
 		if len(config.Matchers[i].ExcludeDirs) == 0 {
 			config.Matchers[i].excludeDirMap = defaultExcludeDirMap
 		} else {
@@ -139,8 +500,82 @@ func normalize(config *Config) (*Config, error) {
 	if config.KillTimeout == 0 {
 		config.KillTimeout = defaultKillTimeout
 	}
+	if config.PortTimeout == 0 {
+		config.PortTimeout = defaultPortTimeout
+	}
+	config.StopSignals = normalizeStopSignals(config.StopSignals, config.KillTimeout)
+	normalizeRestart(&config.Restart)
+	normalizeOutput(&config.Output)
+	if config.Ready != nil {
+		if err := normalizeProbe(config.Ready, config.BaseDir); err != nil {
+			return err
+		}
+	}
+	if config.Diagnostics != nil {
+		if err := normalizeDiagnostics(config.Diagnostics, config.BaseDir); err != nil {
+			return err
+		}
+	}
+	if err := normalizeHooks(&config.Hooks); err != nil {
+		return err
+	}
+	if err := normalizeMode(config); err != nil {
+		return err
+	}
 	log.V("Initializing with config: %+v", config)
-	return config, nil
+	return nil
+}
+
+func normalizeMode(config *Task) error {
+	switch config.Mode {
+	case "":
+		config.Mode = ModeServer
+	case ModeServer:
+	case ModeOneshot:
+		// One-shot tasks are never served, so server options do not apply.
+		switch {
+		case config.BuildBeforeSwap:
+			return errors.New("buildBeforeSwap cannot be used with mode: oneshot")
+		case config.Ready != nil:
+			return errors.New("ready cannot be used with mode: oneshot")
+		case config.Restart.Policy != RestartNever:
+			return errors.New("restart cannot be used with mode: oneshot")
+		}
+	default:
+		return fmt.Errorf("unknown mode %q, must be %v or %v", config.Mode, ModeServer, ModeOneshot)
+	}
+	return nil
+}
+
+func normalizeStep(s *Step) error {
+	if s.Shell != "" {
+		if len(s.Action) > 0 {
+			return errors.New("cannot have both action and shell")
+		}
+		if s.Name == "" {
+			s.Name = defaultShellStepName
+		}
+		s.Action = shellArgs(s.Shell)
+	}
+	if len(s.Action) == 0 {
+		return errors.New("has no action")
+	}
+	if s.Name == "" {
+		s.Name = filepath.Base(s.Action[0])
+	}
+	return nil
+}
+
+// defaultShellStepName is the name of a shell step, since the first word of a shell
+// command is often not the command name (e.g. "for" or "cd").
+const defaultShellStepName = "shell"
+
+// shellArgs returns the arguments to run cmd using the system shell.
+func shellArgs(cmd string) []string {
+	if runtime.GOOS == "windows" {
+		return []string{"cmd", "/C", cmd}
+	}
+	return []string{"/bin/sh", "-c", cmd}
 }
 
 // allPatterns parases patterns specified on the command line.
@@ -157,6 +592,10 @@ func argPatterns(patterns []string) []string {
 func parseArgs(opts *opts) (*Config, error) {
 	c := &Config{}
 	c.Action = opts.Args.Action
+	if opts.Shell {
+		c.Action = nil
+		c.Shell = strings.Join(opts.Args.Action, " ")
+	}
 	c.BaseDir = opts.BaseDir
 
 	if c.BaseDir == "" {
@@ -183,8 +622,26 @@ func parseArgs(opts *opts) (*Config, error) {
 	}}
 	c.ChangeTimeout = opts.ChangeTimeout
 	c.KillTimeout = opts.KillTimeout
+	c.PortTimeout = opts.PortTimeout
+	c.DrainTimeout = opts.DrainTimeout
+	var err error
+	if c.StopSignals, err = parseStopSignals(opts.StopSignals); err != nil {
+		return nil, err
+	}
+	if c.Restart.Policy, err = parseRestartPolicy(opts.Restart); err != nil {
+		return nil, err
+	}
 	c.StdOut = opts.OutFile
 	c.StdErr = opts.ErrFile
+	c.Output.Tee = opts.Tee
+	c.Output.Append = opts.Append
+	c.TTY = opts.TTY
+	if opts.Oneshot {
+		c.Mode = ModeOneshot
+	}
+	if c.Env, err = parseEnvArgs(opts.Env); err != nil {
+		return nil, err
+	}
 	return normalize(c)
 }
 
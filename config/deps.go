@@ -0,0 +1,65 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// sortedNames returns the names of the given tasks in alphabetical order.
+func sortedNames(tasks map[string]*Task) []string {
+	var names []string
+	for name := range tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sortTasks returns the task names sorted so that every task is after its dependencies.
+// It returns an error if a task depends on an unknown task, or if there is a dependency cycle.
+func sortTasks(tasks map[string]*Task) ([]string, error) {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+
+	var order []string
+	state := make(map[string]int)
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			// The cycle starts from the first time we visited this task.
+			for i, p := range path {
+				if p == name {
+					path = path[i:]
+					break
+				}
+			}
+			return fmt.Errorf("dependency cycle: %v", strings.Join(append(path, name), " -> "))
+		}
+
+		state[name] = visiting
+		for _, dep := range tasks[name].DependsOn {
+			if _, ok := tasks[dep]; !ok {
+				return fmt.Errorf("task %v depends on unknown task %v", name, dep)
+			}
+			if err := visit(dep, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		order = append(order, name)
+		return nil
+	}
+
+	for _, name := range sortedNames(tasks) {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
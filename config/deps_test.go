@@ -0,0 +1,86 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSortTasks(t *testing.T) {
+	tests := []struct {
+		msg     string
+		deps    map[string][]string
+		want    []string
+		wantErr string
+	}{
+		{
+			msg:  "no dependencies",
+			deps: map[string][]string{"b": nil, "a": nil, "c": nil},
+			want: []string{"a", "b", "c"},
+		},
+		{
+			msg:  "dependencies before dependents",
+			deps: map[string][]string{"a": {"c"}, "b": {"a"}, "c": nil},
+			want: []string{"c", "a", "b"},
+		},
+		{
+			msg:  "shared dependency",
+			deps: map[string][]string{"api": {"db"}, "web": {"api", "db"}, "db": nil},
+			want: []string{"db", "api", "web"},
+		},
+		{
+			msg:     "unknown dependency",
+			deps:    map[string][]string{"a": {"missing"}},
+			wantErr: "task a depends on unknown task missing",
+		},
+		{
+			msg:     "self dependency",
+			deps:    map[string][]string{"a": {"a"}},
+			wantErr: "dependency cycle: a -> a",
+		},
+		{
+			msg:     "cycle",
+			deps:    map[string][]string{"a": {"b"}, "b": {"c"}, "c": {"a"}},
+			wantErr: "dependency cycle: a -> b -> c -> a",
+		},
+		{
+			msg:     "cycle after a dependency",
+			deps:    map[string][]string{"a": {"b"}, "b": {"c"}, "c": {"b"}},
+			wantErr: "dependency cycle: b -> c -> b",
+		},
+	}
+
+	for _, tt := range tests {
+		tasks := make(map[string]*Task)
+		for name, deps := range tt.deps {
+			tasks[name] = &Task{DependsOn: deps}
+		}
+
+		got, err := sortTasks(tasks)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("%v: sortTasks got error %v, want %q", tt.msg, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: sortTasks failed: %v", tt.msg, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: sortTasks got %v, want %v", tt.msg, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeDependencyCycle(t *testing.T) {
+	c := &Config{
+		Tasks: map[string]*Task{
+			"a": {Shell: "true", DependsOn: []string{"b"}},
+			"b": {Shell: "true", DependsOn: []string{"a"}},
+		},
+	}
+	_, err := normalize(c)
+	if want := "dependency cycle: a -> b -> a"; err == nil || err.Error() != want {
+		t.Errorf("normalize got error %v, want %q", err, want)
+	}
+}
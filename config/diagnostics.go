@@ -0,0 +1,61 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+)
+
+// Diagnostics configures how compiler errors and other diagnostics are parsed
+// from the task's STDERR.
+type Diagnostics struct {
+	// QuickfixFile is written with the diagnostics from the last run, in the
+	// file:line:col: message format that editors such as Vim can load.
+	// A relative path is relative to the task's baseDir.
+	QuickfixFile string `yaml:"quickfixFile"`
+
+	// Parsers are custom parsers, which are tried before the built-in parsers
+	// for Go, gcc/clang and Python.
+	Parsers []DiagnosticParser `yaml:"parsers"`
+}
+
+// DiagnosticParser parses diagnostics using a regular expression that matches a line.
+type DiagnosticParser struct {
+	Name string `yaml:"name"`
+
+	// Pattern must have named groups "file" and "line", and may have the named
+	// groups "col", "severity" and "message".
+	Pattern string `yaml:"regexp"`
+
+	// Regexp is the compiled Pattern.
+	Regexp *regexp.Regexp `yaml:"-"`
+}
+
+func normalizeDiagnostics(d *Diagnostics, baseDir string) error {
+	if d.QuickfixFile != "" && !filepath.IsAbs(d.QuickfixFile) {
+		d.QuickfixFile = filepath.Join(baseDir, d.QuickfixFile)
+	}
+	for i := range d.Parsers {
+		p := &d.Parsers[i]
+		if p.Pattern == "" {
+			return errors.New("diagnostic parser has no regexp")
+		}
+		if p.Name == "" {
+			p.Name = fmt.Sprintf("parser %v", i+1)
+		}
+
+		var err error
+		if p.Regexp, err = regexp.Compile(p.Pattern); err != nil {
+			return fmt.Errorf("invalid regexp for diagnostic parser %v: %v", p.Name, err)
+		}
+		groups := make(map[string]bool)
+		for _, name := range p.Regexp.SubexpNames() {
+			groups[name] = true
+		}
+		if !groups["file"] || !groups["line"] {
+			return fmt.Errorf("regexp for diagnostic parser %v must have named groups file and line", p.Name)
+		}
+	}
+	return nil
+}
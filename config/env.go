@@ -0,0 +1,147 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/prashantv/autobld/log"
+)
+
+// LoadEnv reads the task's envFiles and env, and returns the variables in KEY=VALUE format.
+// Variables in envFiles can use ${VAR} to refer to earlier variables or autobld's
+// environment, and variables in env can also refer to variables from envFiles.
+func LoadEnv(t *Task) ([]string, error) {
+	vars := make(map[string]string)
+	lookup := func(key string) string {
+		if v, ok := vars[key]; ok {
+			return v
+		}
+		return os.Getenv(key)
+	}
+
+	var env []string
+	for _, f := range t.EnvFiles {
+		fileEnv, err := readEnvFile(f, lookup, vars)
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, fileEnv...)
+	}
+
+	// env is expanded using only the variables from envFiles, so the order of the map does not matter.
+	var keys []string
+	for k := range t.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		env = append(env, k+"="+os.Expand(t.Env[k], lookup))
+	}
+	return env, nil
+}
+
+// readEnvFile reads a file in dotenv format, adds all variables to vars, and returns them
+// in KEY=VALUE format. Lines may start with "export", and "#" starts a comment.
+// Values in single quotes are used as-is, while other values are expanded using lookup.
+func readEnvFile(path string, lookup func(string) string, vars map[string]string) ([]string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		// Optional env files such as .env.local may not exist, so they are treated as empty.
+		log.V("Env file %v does not exist, skipping it", path)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var env []string
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+
+		parts := strings.SplitN(line, "=", 2)
+		key := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("%v:%v: invalid line, expected KEY=VALUE", path, lineNum)
+		}
+		value, err := parseEnvValue(strings.TrimSpace(parts[1]), lookup)
+		if err != nil {
+			return nil, fmt.Errorf("%v:%v: %v", path, lineNum, err)
+		}
+		vars[key] = value
+		env = append(env, key+"="+value)
+	}
+	return env, scanner.Err()
+}
+
+func parseEnvValue(v string, lookup func(string) string) (string, error) {
+	if v == "" {
+		return "", nil
+	}
+
+	switch quote := v[0]; quote {
+	case '\'', '"':
+		end := strings.LastIndexByte(v, quote)
+		if end == 0 {
+			return "", fmt.Errorf("unterminated quote in value %v", v)
+		}
+		if quote == '\'' {
+			return v[1:end], nil
+		}
+		unquoted := strings.NewReplacer(`\n`, "\n", `\"`, `"`, `\\`, `\`).Replace(v[1:end])
+		return os.Expand(unquoted, lookup), nil
+	}
+
+	// Unquoted values can have a trailing comment.
+	if i := strings.Index(v, " #"); i >= 0 {
+		v = strings.TrimSpace(v[:i])
+	}
+	return os.Expand(v, lookup), nil
+}
+
+// parseEnvArgs parses variables passed through flags in KEY=VALUE format.
+func parseEnvArgs(args []string) (map[string]string, error) {
+	env := make(map[string]string)
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("env is not in format KEY=VALUE, got %v", arg)
+		}
+		env[parts[0]] = parts[1]
+	}
+	return env, nil
+}
+
+// normalizeEnvFiles makes envFiles relative to baseDir, and adds a matcher for each
+// env file so that the task is reloaded when an env file changes.
+func normalizeEnvFiles(t *Task) error {
+	for i, f := range t.EnvFiles {
+		if !filepath.IsAbs(f) {
+			f = filepath.Join(t.BaseDir, f)
+		}
+		t.EnvFiles[i] = f
+
+		dir, err := filepath.Rel(t.BaseDir, filepath.Dir(f))
+		if err != nil {
+			return err
+		}
+		t.Matchers = append(t.Matchers, Matcher{
+			Patterns:  []string{filepath.Base(f)},
+			Dirs:      []string{dir},
+			noRecurse: true,
+		})
+	}
+
+	// Load the environment to validate the env files.
+	_, err := LoadEnv(t)
+	return err
+}
@@ -0,0 +1,49 @@
+package config
+
+import "testing"
+
+func TestParseEnvValue(t *testing.T) {
+	lookup := func(k string) string {
+		if k == "HOME" {
+			return "/home/user"
+		}
+		return ""
+	}
+
+	tests := []struct {
+		v       string
+		want    string
+		wantErr bool
+	}{
+		{v: "", want: ""},
+		{v: "plain", want: "plain"},
+		{v: "value # comment", want: "value"},
+		{v: "a#b", want: "a#b"},
+		{v: "$HOME/bin", want: "/home/user/bin"},
+		{v: "${HOME}/bin", want: "/home/user/bin"},
+		{v: "$MISSING", want: ""},
+		{v: `'single $HOME # not a comment'`, want: "single $HOME # not a comment"},
+		{v: `"double $HOME"`, want: "double /home/user"},
+		{v: `"line\nbreak"`, want: "line\nbreak"},
+		{v: `"say \"hi\" \\ bye"`, want: `say "hi" \ bye`},
+		{v: `'unterminated`, wantErr: true},
+		{v: `"unterminated`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseEnvValue(tt.v, lookup)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseEnvValue(%q) got %q, want error", tt.v, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseEnvValue(%q) failed: %v", tt.v, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseEnvValue(%q) got %q, want %q", tt.v, got, tt.want)
+		}
+	}
+}
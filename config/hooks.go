@@ -0,0 +1,65 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+const defaultHookTimeout = 30 * time.Second
+
+// Hooks are commands that are run at points in the task's lifecycle.
+type Hooks struct {
+	// BeforeStart is run before the server is started, once any build steps have succeeded.
+	BeforeStart *Hook `yaml:"beforeStart"`
+	// AfterStart is run once the server is ready.
+	AfterStart *Hook `yaml:"afterStart"`
+	// BeforeStop is run before the first stop signal is sent to the server.
+	BeforeStop *Hook `yaml:"beforeStop"`
+	// AfterStop is run once the server has exited after being stopped.
+	AfterStop *Hook `yaml:"afterStop"`
+	// OnCrash is run when the server exits without being stopped.
+	OnCrash *Hook `yaml:"onCrash"`
+	// OnChangeDetected is run when a file change is detected, before the task is restarted.
+	OnChangeDetected *Hook `yaml:"onChangeDetected"`
+}
+
+// Hook is a command that is run at a point in the task's lifecycle.
+type Hook struct {
+	Step `yaml:",inline"`
+
+	// Timeout is how long the hook can run before it is killed.
+	Timeout time.Duration `yaml:"timeout"`
+
+	// AbortOnFailure cancels the restart if the hook fails. It can only be used
+	// for beforeStart and onChangeDetected.
+	AbortOnFailure bool `yaml:"abortOnFailure"`
+}
+
+func normalizeHooks(h *Hooks) error {
+	for _, hook := range []struct {
+		name     string
+		hook     *Hook
+		canAbort bool
+	}{
+		{"beforeStart", h.BeforeStart, true},
+		{"afterStart", h.AfterStart, false},
+		{"beforeStop", h.BeforeStop, false},
+		{"afterStop", h.AfterStop, false},
+		{"onCrash", h.OnCrash, false},
+		{"onChangeDetected", h.OnChangeDetected, true},
+	} {
+		if hook.hook == nil {
+			continue
+		}
+		if err := normalizeStep(&hook.hook.Step); err != nil {
+			return fmt.Errorf("hook %v %v", hook.name, err)
+		}
+		if hook.hook.Timeout == 0 {
+			hook.hook.Timeout = defaultHookTimeout
+		}
+		if hook.hook.AbortOnFailure && !hook.canAbort {
+			return fmt.Errorf("hook %v cannot use abortOnFailure", hook.name)
+		}
+	}
+	return nil
+}
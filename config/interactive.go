@@ -0,0 +1,45 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+const defaultInteractivePrefix = "ctrl-t"
+
+// Interactive configures the keyboard commands that can be typed on stdin.
+type Interactive struct {
+	// Enabled enables keyboard commands. All other input is still sent to the task.
+	Enabled bool `yaml:"enabled"`
+
+	// Prefix is the key that is pressed before a command key, e.g. ctrl-t (default).
+	// Pressing the prefix key twice sends it to the task.
+	Prefix string `yaml:"prefix"`
+
+	// PrefixKey is the byte sent by the terminal for Prefix.
+	PrefixKey byte `yaml:"-"`
+}
+
+// parseKey parses a control key specified as ctrl-x, c-x or ^x.
+func parseKey(s string) (byte, error) {
+	lower := strings.ToLower(s)
+	for _, p := range []string{"ctrl-", "ctrl+", "c-", "^"} {
+		if strings.HasPrefix(lower, p) {
+			key := lower[len(p):]
+			if len(key) == 1 && key[0] >= 'a' && key[0] <= 'z' {
+				return key[0] & 0x1f, nil
+			}
+			break
+		}
+	}
+	return 0, fmt.Errorf("invalid key %q, must be a control key such as ctrl-t", s)
+}
+
+func normalizeInteractive(i *Interactive) error {
+	if i.Prefix == "" {
+		i.Prefix = defaultInteractivePrefix
+	}
+	var err error
+	i.PrefixKey, err = parseKey(i.Prefix)
+	return err
+}
@@ -0,0 +1,39 @@
+package config
+
+import "testing"
+
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    byte
+		wantErr bool
+	}{
+		{s: "ctrl-t", want: 0x14},
+		{s: "Ctrl-T", want: 0x14},
+		{s: "ctrl+a", want: 0x01},
+		{s: "C-b", want: 0x02},
+		{s: "^z", want: 0x1a},
+		{s: "t", wantErr: true},
+		{s: "ctrl-", wantErr: true},
+		{s: "ctrl-1", wantErr: true},
+		{s: "ctrl-tt", wantErr: true},
+		{s: "alt-t", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseKey(tt.s)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseKey(%q) got %#x, want error", tt.s, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseKey(%q) failed: %v", tt.s, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseKey(%q) got %#x, want %#x", tt.s, got, tt.want)
+		}
+	}
+}
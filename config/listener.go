@@ -11,12 +11,13 @@ import (
 	"gopkg.in/fsnotify.v1"
 )
 
-func setupListener(c *Config, m Matcher, watcher *fsnotify.Watcher) error {
-	if len(m.Dirs) == 0 {
-		m.Dirs = []string{""}
+func setupListener(c *Task, m *Matcher, watcher *fsnotify.Watcher) error {
+	dirs := m.Dirs
+	if len(dirs) == 0 {
+		dirs = []string{""}
 	}
 
-	for _, d := range m.Dirs {
+	for _, d := range dirs {
 		dir := c.BaseDir + "/" + d
 		if err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 			if err != nil {
@@ -28,8 +29,11 @@ func setupListener(c *Config, m Matcher, watcher *fsnotify.Watcher) error {
 			}
 			if info.IsDir() {
 				log.VV("Add watch for directory %v", path)
-				c.configsMap[filepath.Clean(path)] = &m
+				c.configsMap[filepath.Clean(path)] = append(c.configsMap[filepath.Clean(path)], m)
 				watcher.Add(path)
+				if m.noRecurse {
+					return filepath.SkipDir
+				}
 			}
 			return nil
 		}); err != nil {
@@ -48,38 +52,56 @@ func wrapErr(err error) error {
 	return err
 }
 
-// SetupWatcher sets up fsnotify to watch all the directories specified in the config.
+// SetupWatcher sets up fsnotify to watch all the directories specified by all tasks in the config.
 func SetupWatcher(c *Config) (*fsnotify.Watcher, error) {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return nil, wrapErr(err)
 	}
 
-	for _, m := range c.Matchers {
-		if err := setupListener(c, m, watcher); err != nil {
-			return nil, wrapErr(err)
+	for _, name := range c.TaskNames() {
+		t := c.Tasks[name]
+		for i := range t.Matchers {
+			if err := setupListener(t, &t.Matchers[i], watcher); err != nil {
+				return nil, wrapErr(err)
+			}
 		}
 	}
 	return watcher, nil
 }
 
-// IsMatch checks whether an event on the given path should cause a reload.
-func IsMatch(c *Config, path string) bool {
+// Match returns the matchers for an event on the given path, or nil if the event
+// should be ignored by the task. If any matchers that restart the task match, only
+// those matchers are returned, so that the Run command of each of them is run.
+func Match(c *Task, path string) []*Matcher {
 	dir, file := filepath.Split(path)
 	if len(dir) == 0 {
 		dir = "./"
 	}
-	dc := c.configsMap[filepath.Clean(dir)]
-	if dc == nil {
-		return false
+	var restart, signal []*Matcher
+	for _, m := range c.configsMap[filepath.Clean(dir)] {
+		log.VV("Found updated file (%v) in watched directory, config: %+v", path, m)
+		if !isMatch(m, file) {
+			continue
+		}
+		if m.OnChange == OnChangeRestart {
+			restart = append(restart, m)
+		} else {
+			signal = append(signal, m)
+		}
 	}
-	log.VV("Found updated file (%v) in watched directory, config: %+v", path, dc)
+	if len(restart) > 0 {
+		return restart
+	}
+	return signal
+}
 
+func isMatch(m *Matcher, file string) bool {
 	// If there are no patterns, then we treat it as a wildcard matching everything.
-	if len(dc.Patterns) == 0 {
+	if len(m.Patterns) == 0 {
 		return true
 	}
-	for _, p := range dc.Patterns {
+	for _, p := range m.Patterns {
 		if match, err := filepath.Match(p, file); err == nil && match {
 			return true
 		}
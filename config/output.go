@@ -0,0 +1,96 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const defaultMaxFiles = 5
+
+// Output configures how the task's outFile and errFile are written.
+type Output struct {
+	// Tee writes the output to the terminal as well as to the file.
+	Tee bool `yaml:"tee"`
+
+	// Append appends to the file instead of truncating it for every run.
+	Append bool `yaml:"append"`
+
+	// PerRun writes every run to a new file, with a timestamp added to the file name.
+	PerRun bool `yaml:"perRun"`
+
+	// MaxSize is the size at which the file is rotated. 0 disables rotation.
+	MaxSize ByteSize `yaml:"maxSize"`
+
+	// MaxFiles is the number of rotated or per-run files to keep. The default is 5.
+	MaxFiles int `yaml:"maxFiles"`
+
+	// Prefix is prepended to every line of output. It can contain the placeholders
+	// {task}, {run}, {step} and {stream}.
+	Prefix string `yaml:"prefix"`
+
+	// Timestamps prepends the time to every line of output.
+	Timestamps bool `yaml:"timestamps"`
+
+	// Color colors the prefix and timestamps when writing to the terminal.
+	Color bool `yaml:"color"`
+
+	// Banner prints a separator line before every run of the task.
+	Banner bool `yaml:"banner"`
+}
+
+// LineProcessing returns whether every line of output needs to be processed.
+// If not, the output is written as-is, so binary output is unaffected.
+func (o Output) LineProcessing() bool {
+	return o.Prefix != "" || o.Timestamps
+}
+
+// ByteSize is a size in bytes, which can be specified with a suffix (e.g. 10MB).
+type ByteSize int64
+
+var byteSizeSuffixes = []struct {
+	suffix string
+	size   ByteSize
+}{
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"G", 1 << 30},
+	{"M", 1 << 20},
+	{"K", 1 << 10},
+	{"B", 1},
+}
+
+func parseByteSize(s string) (ByteSize, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	multiplier := ByteSize(1)
+	for _, suffix := range byteSizeSuffixes {
+		if strings.HasSuffix(s, suffix.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, suffix.suffix))
+			multiplier = suffix.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %v", s)
+	}
+	return ByteSize(n) * multiplier, nil
+}
+
+// UnmarshalYAML is used to unmarshal ByteSize from the YAML configuration.
+func (b *ByteSize) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	var err error
+	*b, err = parseByteSize(s)
+	return err
+}
+
+func normalizeOutput(o *Output) {
+	if o.MaxFiles == 0 {
+		o.MaxFiles = defaultMaxFiles
+	}
+}
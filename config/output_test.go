@@ -0,0 +1,44 @@
+package config
+
+import "testing"
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    ByteSize
+		wantErr bool
+	}{
+		{s: "0", want: 0},
+		{s: "100", want: 100},
+		{s: "100B", want: 100},
+		{s: "10K", want: 10 << 10},
+		{s: "10KB", want: 10 << 10},
+		{s: "10kb", want: 10 << 10},
+		{s: "5MB", want: 5 << 20},
+		{s: " 5 mb ", want: 5 << 20},
+		{s: "2G", want: 2 << 30},
+		{s: "2GB", want: 2 << 30},
+		{s: "", wantErr: true},
+		{s: "MB", wantErr: true},
+		{s: "-1MB", wantErr: true},
+		{s: "1.5MB", wantErr: true},
+		{s: "10TB", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseByteSize(tt.s)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseByteSize(%q) got %v, want error", tt.s, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseByteSize(%q) failed: %v", tt.s, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseByteSize(%q) got %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultProbeTimeout  = time.Minute
+	defaultProbeInterval = 200 * time.Millisecond
+	defaultProbeStatus   = 200
+)
+
+// Probe is a readiness probe used to decide when a task has started.
+// Exactly one of TCP, HTTP, Stdout or File must be specified.
+type Probe struct {
+	// TCP is an address (or just a port on localhost) that must accept connections.
+	TCP string `yaml:"tcp"`
+
+	// HTTP is a URL that must return Status for a GET request.
+	HTTP   string `yaml:"http"`
+	Status int    `yaml:"status"`
+
+	// Stdout is a regular expression that must match a line in the task's STDOUT.
+	Stdout string `yaml:"stdout"`
+
+	// File is a file that must be created or modified after the task starts.
+	// A relative path is relative to the task's baseDir.
+	File string `yaml:"file"`
+
+	// Timeout is how long to wait for the task to be ready before the start is treated as failed.
+	Timeout time.Duration `yaml:"timeout"`
+	// Interval is how often the probe is checked.
+	Interval time.Duration `yaml:"interval"`
+
+	// StdoutRegexp is the compiled Stdout regular expression.
+	StdoutRegexp *regexp.Regexp `yaml:"-"`
+}
+
+func normalizeProbe(p *Probe, baseDir string) error {
+	var set int
+	for _, v := range []string{p.TCP, p.HTTP, p.Stdout, p.File} {
+		if v != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return errors.New("ready must specify exactly one of tcp, http, stdout or file")
+	}
+
+	if _, err := strconv.Atoi(p.TCP); err == nil {
+		p.TCP = "localhost:" + p.TCP
+	}
+	if p.Stdout != "" {
+		var err error
+		if p.StdoutRegexp, err = regexp.Compile(p.Stdout); err != nil {
+			return fmt.Errorf("invalid ready stdout pattern: %v", err)
+		}
+	}
+	if p.File != "" && !filepath.IsAbs(p.File) {
+		p.File = filepath.Join(baseDir, p.File)
+	}
+	if p.Status == 0 {
+		p.Status = defaultProbeStatus
+	}
+	if p.Timeout == 0 {
+		p.Timeout = defaultProbeTimeout
+	}
+	if p.Interval == 0 {
+		p.Interval = defaultProbeInterval
+	}
+	return nil
+}
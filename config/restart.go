@@ -0,0 +1,97 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RestartPolicy controls whether a task is restarted when it exits without a change.
+type RestartPolicy int
+
+// List of restart policies.
+const (
+	// RestartNever waits for the next change before restarting the task.
+	RestartNever RestartPolicy = iota
+	// RestartOnFailure restarts the task if it exits with a non-zero exit code or a signal.
+	RestartOnFailure
+	// RestartAlways restarts the task whenever it exits.
+	RestartAlways
+)
+
+const (
+	defaultRestartBackoff    = time.Second
+	defaultRestartMaxBackoff = 30 * time.Second
+	defaultCrashLoopCount    = 5
+	defaultCrashLoopWindow   = time.Minute
+)
+
+// Restart is the configuration for restarting a task when it exits.
+type Restart struct {
+	// Policy is one of never, on-failure or always. The default is never.
+	Policy RestartPolicy `yaml:"policy"`
+
+	// Backoff is the delay before the first restart. The delay doubles
+	// for every attempt, up to MaxBackoff.
+	Backoff    time.Duration `yaml:"backoff"`
+	MaxBackoff time.Duration `yaml:"maxBackoff"`
+
+	// MaxAttempts is the number of restarts before giving up. 0 is unlimited.
+	// The attempts are reset when a change is detected.
+	MaxAttempts int `yaml:"maxAttempts"`
+
+	// If the task exits CrashLoopCount times within CrashLoopWindow, it is treated
+	// as a crash loop, and the task is not restarted till the next change.
+	CrashLoopCount  int           `yaml:"crashLoopCount"`
+	CrashLoopWindow time.Duration `yaml:"crashLoopWindow"`
+}
+
+func parseRestartPolicy(s string) (RestartPolicy, error) {
+	switch strings.ToLower(s) {
+	case "", "never", "no":
+		return RestartNever, nil
+	case "on-failure", "onfailure":
+		return RestartOnFailure, nil
+	case "always":
+		return RestartAlways, nil
+	}
+	return RestartNever, fmt.Errorf("unknown restart policy: %v", s)
+}
+
+// UnmarshalYAML is used to unmarshal RestartPolicy from the YAML configuration.
+func (p *RestartPolicy) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	var err error
+	*p, err = parseRestartPolicy(s)
+	return err
+}
+
+func (p RestartPolicy) String() string {
+	switch p {
+	case RestartNever:
+		return "never"
+	case RestartOnFailure:
+		return "on-failure"
+	case RestartAlways:
+		return "always"
+	}
+	return fmt.Sprintf("RestartPolicy(%d)", int(p))
+}
+
+func normalizeRestart(r *Restart) {
+	if r.Backoff == 0 {
+		r.Backoff = defaultRestartBackoff
+	}
+	if r.MaxBackoff == 0 {
+		r.MaxBackoff = defaultRestartMaxBackoff
+	}
+	if r.CrashLoopCount == 0 {
+		r.CrashLoopCount = defaultCrashLoopCount
+	}
+	if r.CrashLoopWindow == 0 {
+		r.CrashLoopWindow = defaultCrashLoopWindow
+	}
+}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Signal is a signal that can be specified by name (e.g. SIGTERM or TERM) or by number.
+type Signal syscall.Signal
+
+// signals maps signal names to signals. Platform specific signals are added in init.
+var signals = map[string]syscall.Signal{
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGINT":  syscall.SIGINT,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGABRT": syscall.SIGABRT,
+	"SIGKILL": syscall.SIGKILL,
+	"SIGTERM": syscall.SIGTERM,
+}
+
+// handledSignals are the signals that autobld handles itself, so they cannot be forwarded.
+var handledSignals = map[syscall.Signal]bool{
+	syscall.SIGINT:  true,
+	syscall.SIGTERM: true,
+	syscall.SIGHUP:  true,
+	syscall.SIGQUIT: true,
+	syscall.SIGKILL: true,
+}
+
+// ParseSignal parses a signal name or number.
+func ParseSignal(s string) (Signal, error) {
+	name := strings.ToUpper(strings.TrimSpace(s))
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	if sig, ok := signals[name]; ok {
+		return Signal(sig), nil
+	}
+	if n, err := strconv.Atoi(s); err == nil && n > 0 {
+		return Signal(n), nil
+	}
+	return 0, fmt.Errorf("unknown signal: %v", s)
+}
+
+// UnmarshalYAML is used to unmarshal Signal from the YAML configuration.
+func (s *Signal) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var str string
+	if err := unmarshal(&str); err != nil {
+		return err
+	}
+	var err error
+	*s, err = ParseSignal(str)
+	return err
+}
+
+func (s Signal) String() string {
+	for name, sig := range signals {
+		if Signal(sig) == s {
+			return name
+		}
+	}
+	return fmt.Sprintf("signal %d", int(s))
+}
+
+// StopSignal is a signal sent to stop a task, and how long to wait for the task
+// to exit before sending the next signal.
+type StopSignal struct {
+	Signal  Signal        `yaml:"signal"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// parseStopSignals parses stop signals passed through flags, in the format SIGNAL[:timeout].
+func parseStopSignals(args []string) ([]StopSignal, error) {
+	var stopSignals []StopSignal
+	for _, arg := range argPatterns(args) {
+		parts := strings.SplitN(arg, ":", 2)
+		sig, err := ParseSignal(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		s := StopSignal{Signal: sig}
+		if len(parts) > 1 {
+			if s.Timeout, err = time.ParseDuration(parts[1]); err != nil {
+				return nil, err
+			}
+		}
+		stopSignals = append(stopSignals, s)
+	}
+	return stopSignals, nil
+}
+
+// checkForwardSignals returns an error if any of the signals cannot be forwarded to tasks.
+func checkForwardSignals(sigs []Signal) error {
+	for _, sig := range sigs {
+		if handledSignals[syscall.Signal(sig)] {
+			return fmt.Errorf("cannot forward %v, it is handled by autobld", sig)
+		}
+	}
+	return nil
+}
+
+// normalizeStopSignals defaults to sending SIGINT, and then SIGKILL after killTimeout.
+// SIGKILL is added if it is not the last signal, so a task that ignores the other signals
+// is always stopped. Any signal without a timeout (other than the last one) uses killTimeout.
+func normalizeStopSignals(stopSignals []StopSignal, killTimeout time.Duration) []StopSignal {
+	if len(stopSignals) == 0 {
+		stopSignals = []StopSignal{{Signal: Signal(syscall.SIGINT)}}
+	}
+	if last := stopSignals[len(stopSignals)-1]; last.Signal != Signal(syscall.SIGKILL) {
+		stopSignals = append(stopSignals, StopSignal{Signal: Signal(syscall.SIGKILL)})
+	}
+	for i := range stopSignals[:len(stopSignals)-1] {
+		if stopSignals[i].Timeout == 0 {
+			stopSignals[i].Timeout = killTimeout
+		}
+	}
+	return stopSignals
+}
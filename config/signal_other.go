@@ -0,0 +1,18 @@
+// +build !windows
+
+package config
+
+import "syscall"
+
+func init() {
+	for name, sig := range map[string]syscall.Signal{
+		"SIGUSR1":  syscall.SIGUSR1,
+		"SIGUSR2":  syscall.SIGUSR2,
+		"SIGCONT":  syscall.SIGCONT,
+		"SIGSTOP":  syscall.SIGSTOP,
+		"SIGTSTP":  syscall.SIGTSTP,
+		"SIGWINCH": syscall.SIGWINCH,
+	} {
+		signals[name] = sig
+	}
+}
@@ -0,0 +1,47 @@
+package config
+
+import (
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestNormalizeStopSignals(t *testing.T) {
+	var (
+		sigint  = Signal(syscall.SIGINT)
+		sigterm = Signal(syscall.SIGTERM)
+		sigkill = Signal(syscall.SIGKILL)
+	)
+	tests := []struct {
+		msg  string
+		in   []StopSignal
+		want []StopSignal
+	}{
+		{
+			msg:  "default",
+			want: []StopSignal{{sigint, time.Second}, {sigkill, 0}},
+		},
+		{
+			msg:  "ends with SIGKILL",
+			in:   []StopSignal{{sigterm, 5 * time.Second}, {sigint, 0}, {sigkill, 0}},
+			want: []StopSignal{{sigterm, 5 * time.Second}, {sigint, time.Second}, {sigkill, 0}},
+		},
+		{
+			msg:  "SIGKILL is added",
+			in:   []StopSignal{{sigterm, 5 * time.Second}},
+			want: []StopSignal{{sigterm, 5 * time.Second}, {sigkill, 0}},
+		},
+		{
+			msg:  "SIGKILL is added after the kill timeout",
+			in:   []StopSignal{{sigterm, 0}},
+			want: []StopSignal{{sigterm, time.Second}, {sigkill, 0}},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeStopSignals(tt.in, time.Second); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: normalizeStopSignals got %v, want %v", tt.msg, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/prashantv/autobld/log"
+	"github.com/prashantv/autobld/task"
+)
+
+// keyboard handles the keyboard commands typed by the user.
+type keyboard struct {
+	// commands is nil if keyboard commands are not enabled.
+	commands <-chan task.Command
+	prefix   string
+	// paused is set while changes are ignored.
+	paused bool
+}
+
+var logLevels = []string{"quiet", "normal", "verbose", "very verbose"}
+
+// handle runs the given command, and returns whether autobld should quit.
+func (kb *keyboard) handle(cmd task.Command, taskSMs []*task.SM) bool {
+	switch cmd {
+	case task.CommandRestart:
+		log.L("Restarting all tasks")
+		restartTasks(taskSMs)
+	case task.CommandPause:
+		kb.paused = !kb.paused
+		if kb.paused {
+			log.L("Watching paused, changes will be ignored")
+		} else {
+			log.L("Watching resumed")
+		}
+	case task.CommandVerbose:
+		level := log.Level() + 1
+		if level >= len(logLevels)-1 {
+			level = 0
+		}
+		log.SetLevel(level)
+		log.L("Log level is %v", logLevels[level+1])
+	case task.CommandClear:
+		fmt.Print("\x1b[H\x1b[2J\x1b[3J")
+	case task.CommandStatus:
+		if kb.paused {
+			log.L("Watching is paused")
+		}
+		logStatus(taskSMs)
+	case task.CommandQuit:
+		log.L("Quitting")
+		return true
+	case task.CommandHelp:
+		log.L("Keyboard commands, press %v then: %v", kb.prefix, task.CommandsHelp)
+	}
+	return false
+}
+
+// restartTasks restarts all the tasks, as if a file had changed.
+func restartTasks(taskSMs []*task.SM) {
+	for _, taskSM := range taskSMs {
+		taskSM.Reload("")
+	}
+}
+
+// logStatus logs the status of every task.
+func logStatus(taskSMs []*task.SM) {
+	for _, taskSM := range taskSMs {
+		name := taskSM.Config().Name
+		if name == "" {
+			name = "task"
+		}
+		log.L("%v: %v", name, taskSM.Status())
+	}
+}
@@ -2,6 +2,7 @@ package log
 
 import (
 	"os"
+	"sync/atomic"
 
 	slog "log"
 )
@@ -15,24 +16,23 @@ var (
 	normal   = slog.New(os.Stdout, prefix+"L  ", flags)
 	verbose1 = slog.New(os.Stdout, prefix+"V  ", flags)
 	verbose2 = slog.New(os.Stdout, prefix+"VV ", flags)
+
+	// level is accessed atomically, as it can be changed while autobld is running.
+	level int32
 )
 
 // SetLevel sets the logging level. -1 is quiet, 0 is normal, anything higher is verbosity level.
-func SetLevel(level int) {
-	switch level {
-	case -1:
-		normal = nil
-		fallthrough
-	case 0:
-		verbose1 = nil
-		fallthrough
-	case 1:
-		verbose2 = nil
-	}
+func SetLevel(l int) {
+	atomic.StoreInt32(&level, int32(l))
+}
+
+// Level returns the current logging level.
+func Level() int {
+	return int(atomic.LoadInt32(&level))
 }
 
-func log(logger *slog.Logger, format string, v ...interface{}) bool {
-	if logger == nil {
+func log(minLevel int, logger *slog.Logger, format string, v ...interface{}) bool {
+	if Level() < minLevel {
 		return false
 	}
 	if len(v) == 0 {
@@ -45,17 +45,17 @@ func log(logger *slog.Logger, format string, v ...interface{}) bool {
 
 // L is used for normal level logs.
 func L(format string, v ...interface{}) bool {
-	return log(normal, format, v...)
+	return log(0, normal, format, v...)
 }
 
 // V is used for verbose logs.
 func V(format string, v ...interface{}) bool {
-	return log(verbose1, format, v...)
+	return log(1, verbose1, format, v...)
 }
 
 // VV is used for very verbose logs.
 func VV(format string, v ...interface{}) bool {
-	return log(verbose2, format, v...)
+	return log(2, verbose2, format, v...)
 }
 
 // Fatalf is used to log and close the application.
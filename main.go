@@ -3,9 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
-	"os/signal"
 	"sync"
-	"syscall"
 
 	"github.com/prashantv/autobld/config"
 	"github.com/prashantv/autobld/log"
@@ -21,40 +19,79 @@ func main() {
 		log.Fatalf("Configuration error: %v", err)
 	}
 
+	// errC is used to report errors. Any error will cause a log.Fatal
+	errC := make(chan error)
+	// signalC is used for signals to this process (ctrl+c, etc).
+	signals, signalC := notifySignals(c)
+	if c.Init {
+		if err := task.StartReaper(); err != nil {
+			log.L("Zombie processes will not be reaped: %v", err)
+		}
+	}
+
+	// reprocessC is shared by all the task state machines to trigger a reprocess.
+	reprocessC := make(chan struct{})
+	var taskSMs []*task.SM
+	smByName := make(map[string]*task.SM)
+	for _, name := range c.TaskNames() {
+		tc := c.Tasks[name]
+
+		// Start the task's proxy listeners, and ensure they block initially till the task starts.
+		// Each task has its own WaitGroup so that proxies only block while their own task reloads.
+		blockRequests := &sync.WaitGroup{}
+		blockRequests.Add(1)
+		backend := proxy.NewBackend()
+		for _, pc := range tc.ProxyConfigs {
+			proxy.Start(pc, blockRequests, backend, errC)
+		}
+		taskSM := task.NewSM(tc, blockRequests, backend, reprocessC)
+		for _, dep := range tc.DependsOn {
+			taskSM.DependsOn(smByName[dep])
+		}
+		smByName[name] = taskSM
+		taskSMs = append(taskSMs, taskSM)
+	}
+
+	if c.Once {
+		exitCode, err := onceLoop(c, taskSMs, reprocessC, errC, signalC, signals)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		os.Exit(exitCode)
+	}
+
 	watcher, err := config.SetupWatcher(c)
 	if err != nil {
 		log.Fatalf("Change detection failed: %v", err)
 	}
 
-	var (
-		// errC is used to report errors. Any error will cause a log.Fatal
-		errC = make(chan error)
-		// signnalC is used for signals to this process (ctrl+c, etc).
-		signalC = make(chan os.Signal)
-	)
-	signal.Notify(signalC, syscall.SIGINT, syscall.SIGKILL)
-
-	// Start all the proxy listeners, and ensure they block initially till the task starts.
-	var blockRequests sync.WaitGroup
-	blockRequests.Add(1)
-	for _, pc := range c.ProxyConfigs {
-		proxy.Start(pc, &blockRequests, errC)
+	kb := &keyboard{prefix: c.Interactive.Prefix}
+	restoreTerminal := func() {}
+	if c.Interactive.Enabled {
+		kb.commands, restoreTerminal = task.EnableCommands(c.Interactive.PrefixKey)
+		log.L("Keyboard commands are enabled, press %v then h for help", c.Interactive.Prefix)
 	}
-
-	if err := eventLoop(c, errC, signalC, &blockRequests, watcher); err != nil {
+	if c.UsesTTY() {
+		// With keyboard commands, Ctrl-C is sent to the task, and quit stops autobld.
+		restoreRaw, restoreCommands := task.SetRawTerminal(!c.Interactive.Enabled), restoreTerminal
+		restoreTerminal = func() {
+			restoreRaw()
+			restoreCommands()
+		}
+	}
+	err = eventLoop(taskSMs, reprocessC, errC, signalC, signals, kb, watcher)
+	restoreTerminal()
+	if err != nil {
 		log.Fatalf("Error: %v", err)
 	}
 }
 
-func eventLoop(c *config.Config, errC <-chan error, signalC <-chan os.Signal, blockRequests *sync.WaitGroup, watcher *fsnotify.Watcher) error {
-	taskSM := task.NewSM(c, blockRequests)
-	defer taskSM.Close()
+// executeTasks runs the task state machines in dependency order.
+func executeTasks(taskSMs []*task.SM) error {
+	// Any change in the task state should make the proxy try reconnecting.
+	proxy.RetryConnect()
 
-	for {
-		// Any change in the task state should make the proxy try reconnecting.
-		proxy.RetryConnect()
-
-		// Run the task state machine.
+	for _, taskSM := range taskSMs {
 		for rerun := true; rerun; {
 			var err error
 			rerun, err = taskSM.Execute()
@@ -62,19 +99,54 @@ func eventLoop(c *config.Config, errC <-chan error, signalC <-chan os.Signal, bl
 				return fmt.Errorf("task error: %v", err)
 			}
 		}
+	}
+	return nil
+}
+
+// closeTasks stops the tasks in the reverse order that they were started in.
+func closeTasks(taskSMs []*task.SM) {
+	for i := len(taskSMs) - 1; i >= 0; i-- {
+		taskSMs[i].Close()
+	}
+}
+
+func eventLoop(taskSMs []*task.SM, reprocessC <-chan struct{}, errC <-chan error, signalC <-chan os.Signal, signals *signalHandler, kb *keyboard, watcher *fsnotify.Watcher) error {
+	defer closeTasks(taskSMs)
+
+	for {
+		if err := executeTasks(taskSMs); err != nil {
+			return err
+		}
 
 		select {
 		case err := <-errC:
 			return err
 		case err := <-watcher.Errors:
 			return fmt.Errorf("watcher error: %v", err)
-		case <-signalC:
-			return nil
+		case sig := <-signalC:
+			if quit := signals.handle(sig, taskSMs); quit {
+				return nil
+			}
+		case cmd := <-kb.commands:
+			if quit := kb.handle(cmd, taskSMs); quit {
+				return nil
+			}
 		case event := <-watcher.Events:
-			if config.IsMatch(c, event.Name) && !taskSM.PendingClose() {
-				taskSM.Reload()
+			if kb.paused {
+				log.VV("Ignoring change to %v while watching is paused", event.Name)
+				break
+			}
+			for _, taskSM := range taskSMs {
+				ms := config.Match(taskSM.Config(), event.Name)
+				switch {
+				case len(ms) == 0:
+				case ms[0].OnChange == config.OnChangeSignal:
+					taskSM.Signal(ms[0].Signal)
+				default:
+					taskSM.Reload(event.Name, ms...)
+				}
 			}
-		case <-taskSM.Reprocess:
+		case <-reprocessC:
 			// Nothing needs to be done, just the standard reprocess.
 		}
 	}
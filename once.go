@@ -0,0 +1,149 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"github.com/prashantv/autobld/config"
+	"github.com/prashantv/autobld/log"
+	"github.com/prashantv/autobld/task"
+)
+
+// onceLoop starts the tasks without watching for changes, and waits till they are all
+// ready or one of them fails. If they are ready, the check command is run. The tasks are
+// then stopped, and the exit code for autobld is returned.
+func onceLoop(c *config.Config, taskSMs []*task.SM, reprocessC chan struct{}, errC <-chan error, signalC <-chan os.Signal, signals *signalHandler) (int, error) {
+	defer closeTasks(taskSMs)
+
+	// Servers without a readiness probe are checked till they have run for the start
+	// grace period, and the check is checked for its timeout.
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	var check *task.Task
+	var checkStart time.Time
+	defer func() {
+		if check != nil {
+			stopCheck(check, c.CheckStopSignals())
+		}
+	}()
+	for {
+		if err := executeTasks(taskSMs); err != nil {
+			return 1, err
+		}
+
+		if check != nil {
+			if crashed, code := crashedTask(taskSMs); crashed != nil {
+				log.L("%v exited while the check was running", taskName(crashed))
+				return exitCode(code), nil
+			}
+			if check.Exited() {
+				if !check.Success() {
+					log.L("Check failed (%v)", check.State())
+					return exitCode(check.ExitCode()), nil
+				}
+				log.L("Check passed")
+				return 0, nil
+			}
+			if time.Since(checkStart) > c.CheckTimeout {
+				log.L("Check did not finish within %v", c.CheckTimeout)
+				return 1, nil
+			}
+		} else if finished, code := tasksFinished(taskSMs, c.StartGrace); finished {
+			if code != 0 || c.Check == nil {
+				return code, nil
+			}
+
+			if !log.V("Running check %v: %v", c.Check.Name, c.Check.Action) {
+				log.L("Running check %v", c.Check.Name)
+			}
+			var err error
+			check, err = task.New(task.Options{
+				Dir:    c.BaseDir,
+				Args:   c.Check.Action,
+				Stdout: os.Stdout,
+				Stderr: os.Stderr,
+			})
+			if err != nil {
+				return 1, err
+			}
+			checkStart = time.Now()
+			go func() {
+				check.Wait()
+				reprocessC <- struct{}{}
+			}()
+		}
+
+		select {
+		case err := <-errC:
+			return 1, err
+		case sig := <-signalC:
+			if quit := signals.handle(sig, taskSMs); quit {
+				log.L("Interrupted before the tasks finished")
+				return 1, nil
+			}
+		case <-reprocessC:
+		case <-ticker.C:
+		}
+	}
+}
+
+// tasksFinished returns whether all tasks are ready, or any task has failed.
+// If a task failed, its exit code is returned.
+// Servers without a readiness probe are only ready once they have been running for grace.
+func tasksFinished(taskSMs []*task.SM, grace time.Duration) (bool, int) {
+	if crashed, code := crashedTask(taskSMs); crashed != nil {
+		return true, exitCode(code)
+	}
+
+	allReady := true
+	for _, taskSM := range taskSMs {
+		finished, code := taskSM.Finished(grace)
+		if finished && code != 0 {
+			log.L("%v failed with exit code %v", taskName(taskSM), code)
+			return true, code
+		}
+		allReady = allReady && finished
+	}
+	if allReady {
+		log.L("All tasks are ready")
+	}
+	return allReady, 0
+}
+
+// stopCheck stops the check if it is still running, using the same stop signals as the
+// tasks, and kills any processes it started.
+func stopCheck(check *task.Task, stopSignals []config.StopSignal) {
+	if !check.Exited() {
+		log.V("Stopping check")
+		check.Stop(stopSignals)
+		check.Wait()
+	}
+	check.KillSurvivors()
+}
+
+// crashedTask returns the first task whose server has exited, and its exit code.
+func crashedTask(taskSMs []*task.SM) (*task.SM, int) {
+	for _, taskSM := range taskSMs {
+		if crashed, code := taskSM.Crashed(); crashed {
+			return taskSM, code
+		}
+	}
+	return nil, 0
+}
+
+// taskName returns the name of the task for logs.
+func taskName(taskSM *task.SM) string {
+	if name := taskSM.Config().Name; name != "" {
+		return "Task " + name
+	}
+	return "Task"
+}
+
+// exitCode returns a valid exit code for autobld, as code is -1 if the process was killed.
+func exitCode(code int) int {
+	if code <= 0 {
+		return 1
+	}
+	return code
+}
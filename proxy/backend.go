@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Backend is the state of the task that a task's proxies forward to.
+// It is shared by all the proxies for a task.
+type Backend struct {
+	sync.RWMutex
+	failure *Failure
+
+	// active is the number of HTTP requests currently being proxied to the task.
+	active int32
+}
+
+// Failure describes why the task is not running, which is shown by HTTP proxies.
+type Failure struct {
+	// Task is the name of the task, which is empty for a top-level task.
+	Task string `json:"task,omitempty"`
+	// Step is the name of the step that failed.
+	Step string `json:"step"`
+	// Status describes how the step failed, e.g. "exit code 2".
+	Status string `json:"status"`
+	// ExitCode is the exit code of the step, or -1 if it was killed or did not exit.
+	ExitCode int `json:"exitCode"`
+	// Output is the end of the step's STDERR.
+	Output string `json:"output"`
+	// Time is when the failure happened.
+	Time time.Time `json:"time"`
+}
+
+// NewBackend returns a Backend for a task that has not failed.
+func NewBackend() *Backend {
+	return &Backend{}
+}
+
+// SetFailure records that the task has failed, and is not running.
+func (b *Backend) SetFailure(f *Failure) {
+	b.Lock()
+	defer b.Unlock()
+	b.failure = f
+}
+
+// ClearFailure is called once the task is being restarted or is running again.
+func (b *Backend) ClearFailure() {
+	b.SetFailure(nil)
+}
+
+// Active returns the number of HTTP requests that are currently being proxied to the task.
+// TCP connections are not counted, as they may be idle for their whole lifetime.
+func (b *Backend) Active() int {
+	return int(atomic.LoadInt32(&b.active))
+}
+
+// begin tracks an HTTP request till the returned function is called.
+func (b *Backend) begin() (end func()) {
+	atomic.AddInt32(&b.active, 1)
+	return func() {
+		atomic.AddInt32(&b.active, -1)
+	}
+}
+
+// Failure returns the last failure of the task, or nil if it has not failed.
+func (b *Backend) Failure() *Failure {
+	b.RLock()
+	defer b.RUnlock()
+	return b.failure
+}
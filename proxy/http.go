@@ -19,7 +19,17 @@ func (h *httpProxy) StartListen() {
 }
 
 func (h *httpProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet && r.URL.Path == statusPath {
+		writeStatus(w, h.backend)
+		return
+	}
+
 	h.blockRequests.Wait()
+	if f := h.backend.Failure(); f != nil {
+		writeFailure(w, r, f)
+		return
+	}
+	defer h.backend.begin()()
 	if h.tryConnect.Read() {
 		if _, err := h.connectPort(true /* withRetry */); err != nil {
 			writeErr(w, err)
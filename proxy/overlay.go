@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// statusPath is polled by the error page's script to check whether the task has
+// failed. GET requests for it are answered by the proxy, and not forwarded to the task.
+const statusPath = "/__autobld/status"
+
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+
+var errorPage = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{if .Task}}{{.Task}}: {{end}}{{.Step}} failed</title>
+<style>
+body { margin: 0; padding: 2em; background: #1e1e1e; color: #ddd; font-family: sans-serif; }
+h1 { color: #ff6b6b; font-size: 1.4em; }
+pre { background: #111; padding: 1em; overflow: auto; white-space: pre-wrap; }
+.info { color: #999; }
+</style>
+</head>
+<body>
+<h1>{{if .Task}}{{.Task}}: {{end}}{{.Step}} failed ({{.Status}})</h1>
+<p class="info">At {{.Time.Format "15:04:05"}}. This page will reload once the task is running again.</p>
+{{if .Output}}<pre>{{.Output}}</pre>{{end}}
+<script>
+setInterval(function() {
+  var xhr = new XMLHttpRequest();
+  xhr.open("GET", "` + statusPath + `");
+  xhr.onload = function() {
+    if (!JSON.parse(xhr.responseText).failed) {
+      location.reload();
+    }
+  };
+  xhr.send();
+}, 1000);
+</script>
+</body>
+</html>
+`))
+
+// wantsJSON returns whether the client prefers a JSON response to HTML.
+func wantsJSON(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, "text/html")
+}
+
+// writeFailure writes an error page with the task's failure.
+func writeFailure(w http.ResponseWriter, r *http.Request, f *Failure) {
+	clean := *f
+	clean.Output = ansiEscape.ReplaceAllString(f.Output, "")
+
+	w.Header().Set("Cache-Control", "no-store")
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadGateway)
+		json.NewEncoder(w).Encode(struct {
+			Error string `json:"error"`
+			*Failure
+		}{"task failed", &clean})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusBadGateway)
+	errorPage.Execute(w, &clean)
+}
+
+// writeStatus writes whether the task has failed, which is polled by the error page.
+func writeStatus(w http.ResponseWriter, b *Backend) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(struct {
+		Failed bool `json:"failed"`
+	}{b.Failure() != nil})
+}
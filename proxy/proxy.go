@@ -15,17 +15,20 @@ type proxy struct {
 	errC          chan<- error
 	tryConnect    *syncv.Bool
 	blockRequests *sync.WaitGroup
+	backend       *Backend
 }
 
 var proxies []*proxy
 
 // Start creates a goroutine for the given proxy Config.
-func Start(config Config, blockRequests *sync.WaitGroup, errC chan<- error) {
+// backend is shared by all the proxies for the same task.
+func Start(config Config, blockRequests *sync.WaitGroup, backend *Backend, errC chan<- error) {
 	p := &proxy{
 		config:        config,
 		errC:          errC,
 		tryConnect:    syncv.NewBool(true),
 		blockRequests: blockRequests,
+		backend:       backend,
 	}
 	proxies = append(proxies, p)
 
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/prashantv/autobld/config"
+	"github.com/prashantv/autobld/log"
+	"github.com/prashantv/autobld/task"
+)
+
+// signalHandler handles the signals sent to autobld.
+type signalHandler struct {
+	// init is set when autobld is the init process of a container, where SIGHUP
+	// restarts the tasks and SIGQUIT logs their status instead of stopping autobld.
+	init bool
+	// forward are the signals that are forwarded to the tasks.
+	forward map[os.Signal]config.Signal
+}
+
+// notifySignals registers the signals handled by autobld, and returns the channel
+// that they are delivered on.
+func notifySignals(c *config.Config) (*signalHandler, <-chan os.Signal) {
+	h := &signalHandler{
+		init:    c.Init,
+		forward: make(map[os.Signal]config.Signal),
+	}
+	sigs := []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP}
+	if c.Init {
+		sigs = append(sigs, syscall.SIGQUIT)
+	}
+	for _, sig := range c.ForwardSignals {
+		h.forward[syscall.Signal(sig)] = sig
+		sigs = append(sigs, syscall.Signal(sig))
+	}
+
+	// The channel is buffered so that signals received while tasks are being
+	// processed are not dropped.
+	signalC := make(chan os.Signal, len(sigs))
+	signal.Notify(signalC, sigs...)
+	return h, signalC
+}
+
+// handle handles the signal, and returns whether autobld should quit.
+func (h *signalHandler) handle(sig os.Signal, taskSMs []*task.SM) bool {
+	if fwd, ok := h.forward[sig]; ok {
+		for _, taskSM := range taskSMs {
+			taskSM.Forward(fwd)
+		}
+		return false
+	}
+
+	switch {
+	case h.init && sig == syscall.SIGHUP:
+		log.L("Received SIGHUP, restarting all tasks")
+		restartTasks(taskSMs)
+		return false
+	case h.init && sig == syscall.SIGQUIT:
+		logStatus(taskSMs)
+		return false
+	}
+	log.V("Received %v, stopping tasks", config.Signal(sig.(syscall.Signal)))
+	return true
+}
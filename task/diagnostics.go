@@ -0,0 +1,229 @@
+package task
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prashantv/autobld/config"
+	"github.com/prashantv/autobld/log"
+)
+
+// maxDiagnosticsLogged is the number of diagnostics logged when a step exits.
+const maxDiagnosticsLogged = 10
+
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+
+// builtinParsers parse diagnostics from gcc/clang, and from the Go compiler, go vet and go test.
+// Python tracebacks span multiple lines, so they are parsed by pythonParser.
+var builtinParsers = []config.DiagnosticParser{
+	{
+		Name:   "gcc",
+		Regexp: regexp.MustCompile(`^(?P<file>[^\s:]+):(?P<line>\d+):(?P<col>\d+): (?P<severity>(?:fatal )?error|warning): (?P<message>.*)$`),
+	},
+	{
+		Name:   "go",
+		Regexp: regexp.MustCompile(`^\s*(?:vet: )?(?P<file>[^\s:]+\.go):(?P<line>\d+)(?::(?P<col>\d+))?: (?P<message>.*)$`),
+	},
+}
+
+var (
+	pythonTraceback = "Traceback (most recent call last):"
+	pythonFile      = regexp.MustCompile(`^\s+File "([^"]+)", line (\d+)`)
+	pythonException = regexp.MustCompile(`^[A-Za-z_][\w.]*(:|$)`)
+)
+
+// diagnostic is a single error or warning, with the location it refers to.
+type diagnostic struct {
+	file     string
+	line     int
+	col      int
+	severity string
+	message  string
+}
+
+// String returns the diagnostic in the quickfix format, file:line:col: message.
+func (d diagnostic) String() string {
+	loc := fmt.Sprintf("%v:%v", d.file, d.line)
+	if d.col > 0 {
+		loc += fmt.Sprintf(":%v", d.col)
+	}
+	if d.severity != "" {
+		return fmt.Sprintf("%v: %v: %v", loc, d.severity, d.message)
+	}
+	return fmt.Sprintf("%v: %v", loc, d.message)
+}
+
+// pythonParser parses the location of the innermost frame and the exception from a traceback.
+type pythonParser struct {
+	file string
+	line int
+}
+
+func (p *pythonParser) parse(line string) (diagnostic, bool) {
+	if line == pythonTraceback {
+		p.file = ""
+		return diagnostic{}, false
+	}
+	if m := pythonFile.FindStringSubmatch(line); m != nil {
+		p.file = m[1]
+		p.line, _ = strconv.Atoi(m[2])
+		return diagnostic{}, false
+	}
+	if p.file == "" || line == "" || line[0] == ' ' || line[0] == '\t' {
+		return diagnostic{}, false
+	}
+
+	// The first unindented line after the frames is the exception.
+	file := p.file
+	p.file = ""
+	if !pythonException.MatchString(line) {
+		return diagnostic{}, false
+	}
+	return diagnostic{file: file, line: p.line, severity: "error", message: line}, true
+}
+
+// diagWriter is an io.Writer that parses diagnostics from every line written to it.
+type diagWriter struct {
+	sync.Mutex
+	parsers []config.DiagnosticParser
+	python  pythonParser
+	line    []byte
+	found   []diagnostic
+}
+
+func newDiagWriter(c *config.Diagnostics) *diagWriter {
+	return &diagWriter{
+		parsers: append(append([]config.DiagnosticParser(nil), c.Parsers...), builtinParsers...),
+	}
+}
+
+func (w *diagWriter) Write(p []byte) (int, error) {
+	w.Lock()
+	defer w.Unlock()
+
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			w.append(p)
+			break
+		}
+		w.append(p[:i])
+		w.parseLine()
+		p = p[i+1:]
+	}
+	return n, nil
+}
+
+func (w *diagWriter) append(p []byte) {
+	if remaining := maxLineSize - len(w.line); len(p) > remaining {
+		p = p[:remaining]
+	}
+	w.line = append(w.line, p...)
+}
+
+func (w *diagWriter) parseLine() {
+	line := ansiEscape.ReplaceAllString(strings.TrimRight(string(w.line), "\r"), "")
+	w.line = w.line[:0]
+
+	for _, p := range w.parsers {
+		m := p.Regexp.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		var d diagnostic
+		for i, name := range p.Regexp.SubexpNames() {
+			switch name {
+			case "file":
+				d.file = m[i]
+			case "line":
+				d.line, _ = strconv.Atoi(m[i])
+			case "col":
+				d.col, _ = strconv.Atoi(m[i])
+			case "severity":
+				d.severity = m[i]
+			case "message":
+				d.message = m[i]
+			}
+		}
+		w.found = append(w.found, d)
+		return
+	}
+
+	if d, ok := w.python.parse(line); ok {
+		w.found = append(w.found, d)
+	}
+}
+
+// diagnostics returns the diagnostics found, including any in a final partial line.
+func (w *diagWriter) diagnostics() []diagnostic {
+	w.Lock()
+	defer w.Unlock()
+	if len(w.line) > 0 {
+		w.parseLine()
+	}
+	return w.found
+}
+
+// diagnosticsSummary returns the number of errors and warnings, e.g. "2 errors, 1 warning".
+func diagnosticsSummary(found []diagnostic) string {
+	var errors, warnings int
+	for _, d := range found {
+		if d.severity == "warning" {
+			warnings++
+		} else {
+			errors++
+		}
+	}
+	plural := func(n int, s string) string {
+		if n == 1 {
+			return "1 " + s
+		}
+		return fmt.Sprintf("%v %vs", n, s)
+	}
+	switch {
+	case warnings == 0:
+		return plural(errors, "error")
+	case errors == 0:
+		return plural(warnings, "warning")
+	}
+	return plural(errors, "error") + ", " + plural(warnings, "warning")
+}
+
+// reportDiagnostics logs a summary of the diagnostics from the step that exited,
+// and writes the diagnostics for the run to the quickfix file.
+func (t *SM) reportDiagnostics() {
+	found := t.diag.diagnostics()
+	t.diag = nil
+	t.stepDiagnostics[t.step] = found
+
+	if len(found) > 0 {
+		log.L(t.prefix+"Diagnostics from %v: %v", t.steps[t.step].Name, diagnosticsSummary(found))
+		for i, d := range found {
+			if i == maxDiagnosticsLogged {
+				log.L(t.prefix+"  ... and %v more", len(found)-i)
+				break
+			}
+			log.L(t.prefix+"  %v", d)
+		}
+	}
+
+	qf := t.c.Diagnostics.QuickfixFile
+	if qf == "" {
+		return
+	}
+	var buf bytes.Buffer
+	for _, step := range t.stepDiagnostics {
+		for _, d := range step {
+			fmt.Fprintln(&buf, d)
+		}
+	}
+	if err := ioutil.WriteFile(qf, buf.Bytes(), 0666); err != nil {
+		log.L(t.prefix+"Failed to write quickfix file: %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package task
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prashantv/autobld/config"
+)
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		msg    string
+		output string
+		want   []string
+	}{
+		{
+			msg:    "no diagnostics",
+			output: "building...\nok\n",
+		},
+		{
+			msg:    "gcc",
+			output: "main.c:10:5: error: expected ';'\nlib.c:3:1: warning: unused variable 'x'\nfoo.c:1:1: fatal error: bar.h: No such file\n",
+			want: []string{
+				"main.c:10:5: error: expected ';'",
+				"lib.c:3:1: warning: unused variable 'x'",
+				"foo.c:1:1: fatal error: bar.h: No such file",
+			},
+		},
+		{
+			msg:    "go build and vet",
+			output: "# example\n./main.go:12:2: undefined: foo\nvet: ./util.go:3:10: unreachable code\n",
+			want: []string{
+				"./main.go:12:2: undefined: foo",
+				"./util.go:3:10: unreachable code",
+			},
+		},
+		{
+			msg:    "go test",
+			output: "--- FAIL: TestFoo (0.00s)\n    foo_test.go:20: got 1, want 2\nFAIL\n",
+			want:   []string{"foo_test.go:20: got 1, want 2"},
+		},
+		{
+			msg:    "colors and carriage returns",
+			output: "\x1b[31m./main.go:1:1: bad\x1b[0m\r\n",
+			want:   []string{"./main.go:1:1: bad"},
+		},
+		{
+			msg:    "final partial line",
+			output: "ok\n./main.go:5: missing newline",
+			want:   []string{"./main.go:5: missing newline"},
+		},
+		{
+			msg: "python traceback",
+			output: "Traceback (most recent call last):\n" +
+				"  File \"app.py\", line 10, in <module>\n" +
+				"    main()\n" +
+				"  File \"lib/util.py\", line 3, in main\n" +
+				"    raise ValueError(\"bad\")\n" +
+				"ValueError: bad\n",
+			want: []string{"lib/util.py:3: error: ValueError: bad"},
+		},
+		{
+			msg: "python exception without a message",
+			output: "Traceback (most recent call last):\n" +
+				"  File \"app.py\", line 7, in <module>\n" +
+				"    time.sleep(10)\n" +
+				"KeyboardInterrupt\n",
+			want: []string{"app.py:7: error: KeyboardInterrupt"},
+		},
+		{
+			msg: "python frames without an exception",
+			output: "  File \"app.py\", line 7, in <module>\n" +
+				"not an exception line\n",
+		},
+	}
+
+	for _, tt := range tests {
+		w := newDiagWriter(&config.Diagnostics{})
+		w.Write([]byte(tt.output))
+
+		var got []string
+		for _, d := range w.diagnostics() {
+			got = append(got, d.String())
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: diagnostics got %q, want %q", tt.msg, got, tt.want)
+		}
+	}
+}
+
+func TestDiagnosticsSummary(t *testing.T) {
+	tests := []struct {
+		severities []string
+		want       string
+	}{
+		{[]string{"error"}, "1 error"},
+		{[]string{"error", ""}, "2 errors"},
+		{[]string{"warning"}, "1 warning"},
+		{[]string{"warning", "warning", "error"}, "1 error, 2 warnings"},
+	}
+
+	for _, tt := range tests {
+		var found []diagnostic
+		for _, s := range tt.severities {
+			found = append(found, diagnostic{severity: s})
+		}
+		if got := diagnosticsSummary(found); got != tt.want {
+			t.Errorf("diagnosticsSummary(%v) got %q, want %q", tt.severities, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package task
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/prashantv/autobld/config"
+	"github.com/prashantv/autobld/log"
+)
+
+// Environment variables that describe the reload to the task.
+const (
+	// envChangedFiles is the list of changed files, separated by os.PathListSeparator.
+	envChangedFiles = "AUTOBLD_CHANGED_FILES"
+	envChangedCount = "AUTOBLD_CHANGED_COUNT"
+	envReloadSeq    = "AUTOBLD_RELOAD_SEQ"
+)
+
+// Placeholders that can be used in a task's arguments.
+const (
+	// placeholderChanged expands to one argument per changed file if it is the whole
+	// argument, otherwise it is replaced by the changed files separated by spaces.
+	placeholderChanged = "{changed}"
+	placeholderCount   = "{count}"
+	placeholderSeq     = "{seq}"
+)
+
+// addChange records a changed file that will be passed to the task on the next restart.
+// Paths are made relative to baseDir if possible.
+func (t *SM) addChange(path string) {
+	if rel, err := filepath.Rel(t.c.BaseDir, path); err == nil && !strings.HasPrefix(rel, "..") {
+		path = rel
+	}
+	for _, p := range t.pendingChanges {
+		if p == path {
+			return
+		}
+	}
+	log.VV(t.prefix+"Recording changed file %v", path)
+	t.pendingChanges = append(t.pendingChanges, path)
+}
+
+// nextRun moves the pending changes to the changes for the next run.
+func (t *SM) nextRun() {
+	t.changes = t.pendingChanges
+	t.pendingChanges = nil
+	t.reloadSeq++
+}
+
+// run returns the details of the current run for the given step.
+func (t *SM) run(step config.Step) run {
+	name := t.c.Name
+	if name == "" {
+		name = t.steps[len(t.steps)-1].Name
+	}
+	return run{
+		task:    name,
+		seq:     t.reloadSeq,
+		step:    step.Name,
+		start:   t.runStart,
+		changes: t.changes,
+		first:   t.step == 0,
+	}
+}
+
+// loadEnv loads the task's env files and env, so that changes to the env files are
+// picked up on every restart. If they cannot be loaded, the previous values are used.
+func (t *SM) loadEnv() []string {
+	env, err := config.LoadEnv(t.c)
+	if err != nil {
+		log.L(t.prefix+"Failed to load environment, using the previous values: %v", err)
+		return t.env
+	}
+	t.env = env
+	return env
+}
+
+// runEnv returns the environment variables that describe the current run.
+func (t *SM) runEnv() []string {
+	return []string{
+		envChangedFiles + "=" + strings.Join(t.changes, string(os.PathListSeparator)),
+		envChangedCount + "=" + strconv.Itoa(len(t.changes)),
+		envReloadSeq + "=" + strconv.Itoa(t.reloadSeq),
+	}
+}
+
+// expandArgs replaces the placeholders in the step's arguments with the details for the
+// current run. For shell steps, the changed files are quoted so they cannot run commands.
+func (t *SM) expandArgs(step config.Step) []string {
+	shell := step.Shell != ""
+	changed := t.changes
+	if shell {
+		changed = make([]string, len(t.changes))
+		for i, c := range t.changes {
+			changed[i] = shellQuote(c)
+		}
+	}
+	replacer := strings.NewReplacer(
+		placeholderChanged, strings.Join(changed, " "),
+		placeholderCount, strconv.Itoa(len(t.changes)),
+		placeholderSeq, fmt.Sprint(t.reloadSeq),
+	)
+
+	args := step.Action
+	expanded := make([]string, 0, len(args))
+	for i, arg := range args {
+		if arg == placeholderChanged && i > 0 && !shell {
+			expanded = append(expanded, t.changes...)
+			continue
+		}
+		expanded = append(expanded, replacer.Replace(arg))
+	}
+	return expanded
+}
+
+// shellQuote quotes s so that the system shell treats it as a single argument.
+func shellQuote(s string) string {
+	if runtime.GOOS == "windows" {
+		return `"` + s + `"`
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
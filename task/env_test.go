@@ -0,0 +1,53 @@
+// +build !windows
+
+package task
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prashantv/autobld/config"
+)
+
+func TestExpandArgs(t *testing.T) {
+	changes := []string{"a.go", "it's.go", "a;touch PWNED;.go"}
+	tests := []struct {
+		msg  string
+		step config.Step
+		want []string
+	}{
+		{
+			msg:  "whole argument",
+			step: config.Step{Action: []string{"lint", "{changed}"}},
+			want: []string{"lint", "a.go", "it's.go", "a;touch PWNED;.go"},
+		},
+		{
+			msg:  "part of an argument",
+			step: config.Step{Action: []string{"echo", "files: {changed} ({count}) run {seq}"}},
+			want: []string{"echo", "files: a.go it's.go a;touch PWNED;.go (3) run 2"},
+		},
+		{
+			msg: "shell command",
+			step: config.Step{
+				Shell:  "echo {changed} {count}",
+				Action: []string{"/bin/sh", "-c", "echo {changed} {count}"},
+			},
+			want: []string{"/bin/sh", "-c", `echo 'a.go' 'it'\''s.go' 'a;touch PWNED;.go' 3`},
+		},
+		{
+			msg: "shell command that is only the placeholder",
+			step: config.Step{
+				Shell:  "{changed}",
+				Action: []string{"/bin/sh", "-c", "{changed}"},
+			},
+			want: []string{"/bin/sh", "-c", `'a.go' 'it'\''s.go' 'a;touch PWNED;.go'`},
+		},
+	}
+
+	sm := &SM{changes: changes, reloadSeq: 2}
+	for _, tt := range tests {
+		if got := sm.expandArgs(tt.step); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: expandArgs got %q, want %q", tt.msg, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package task
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"github.com/prashantv/autobld/log"
+	"github.com/prashantv/autobld/proxy"
+)
+
+// maxTailSize is the amount of STDERR kept to show on the HTTP proxy's error page.
+const maxTailSize = 16 * 1024
+
+// tailWriter is an io.Writer that keeps the end of the output written to it.
+type tailWriter struct {
+	sync.Mutex
+	buf []byte
+}
+
+func (w *tailWriter) Write(p []byte) (int, error) {
+	w.Lock()
+	defer w.Unlock()
+
+	w.buf = append(w.buf, p...)
+	if len(w.buf) > maxTailSize {
+		w.buf = append([]byte(nil), w.buf[len(w.buf)-maxTailSize:]...)
+	}
+	return len(p), nil
+}
+
+// String returns the output, starting from the first full line if it was truncated.
+func (w *tailWriter) String() string {
+	w.Lock()
+	defer w.Unlock()
+
+	buf := w.buf
+	if len(buf) == maxTailSize {
+		if i := bytes.IndexByte(buf, '\n'); i >= 0 {
+			buf = buf[i+1:]
+		}
+	}
+	return string(buf)
+}
+
+// hasHTTPProxy returns whether any of the task's proxies show an error page when it fails.
+func (t *SM) hasHTTPProxy() bool {
+	for _, pc := range t.c.ProxyConfigs {
+		if pc.Type == proxy.HTTP {
+			return true
+		}
+	}
+	return false
+}
+
+// cannotStart records that the server cannot be started till the next change.
+func (t *SM) cannotStart(err error) {
+	t.startErr = err
+	log.L(t.prefix+"Task cannot be started: %v, waiting for changes", err)
+	if t.hasHTTPProxy() {
+		t.backend.SetFailure(&proxy.Failure{
+			Task:   t.c.Name,
+			Step:   t.steps[t.step].Name,
+			Status: err.Error(),
+			Time:   time.Now(),
+		})
+	}
+	t.unblock()
+}
+
+// reportFailure records that the current step has failed, so the HTTP proxies show
+// an error page. It is ignored while the previous server is still serving requests.
+func (t *SM) reportFailure(status string) {
+	if t.tail == nil || t.serving() {
+		return
+	}
+	t.backend.SetFailure(&proxy.Failure{
+		Task:     t.c.Name,
+		Step:     t.steps[t.step].Name,
+		Status:   status,
+		ExitCode: t.Task.ExitCode(),
+		Output:   t.tail.String(),
+		Time:     time.Now(),
+	})
+}
@@ -0,0 +1,95 @@
+package task
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/prashantv/autobld/config"
+	"github.com/prashantv/autobld/log"
+)
+
+// deferredChange is a change that was detected while a generator was running.
+type deferredChange struct {
+	path     string
+	matchers []*config.Matcher
+}
+
+// addGenerator adds m to the generators that run before the next restart.
+func (t *SM) addGenerator(m *config.Matcher) {
+	for _, g := range t.generators {
+		if g == m {
+			return
+		}
+	}
+	log.V(t.prefix+"Will run %v before restarting", m.Run)
+	t.generators = append(t.generators, m)
+}
+
+// generatorSteps returns the steps for the next run, which are the pending generators
+// followed by the configured steps. Generators stay pending till they succeed.
+func (t *SM) generatorSteps() []config.Step {
+	t.stepGenerators = append([]*config.Matcher(nil), t.generators...)
+	var steps []config.Step
+	for _, g := range t.stepGenerators {
+		steps = append(steps, config.Step{
+			Name:   filepath.Base(g.Run[0]),
+			Action: g.Run,
+		})
+	}
+	return append(steps, t.c.Steps...)
+}
+
+// generatorExited is called when a step exits. If the step is a generator, it is removed
+// from the pending generators if it succeeded. Changes are deferred till the change
+// timeout after a generator exits, since generators usually modify watched files.
+func (t *SM) generatorExited(success bool) {
+	if t.step >= len(t.stepGenerators) {
+		return
+	}
+
+	if success {
+		g := t.stepGenerators[t.step]
+		for i := range t.generators {
+			if t.generators[i] == g {
+				t.generators = append(t.generators[:i], t.generators[i+1:]...)
+				break
+			}
+		}
+	}
+	t.generatedAt = time.Now()
+	go t.reprocessAfter(t.c.ChangeTimeout)
+}
+
+// generating returns whether a generator is running, or has just exited.
+func (t *SM) generating() bool {
+	if t.Task != nil && t.step < len(t.stepGenerators) && !t.failed {
+		return true
+	}
+	return time.Since(t.generatedAt) < t.c.ChangeTimeout
+}
+
+// deferChange records a change detected while a generator was running, so it can be
+// handled once the generator has exited.
+func (t *SM) deferChange(path string, ms []*config.Matcher) {
+	log.VV(t.prefix+"Deferring change to %v while running generators", path)
+	t.deferred = append(t.deferred, deferredChange{path, ms})
+}
+
+// reloadDeferred reloads the task for the changes deferred while generators were running.
+// Files that were last modified before the generator exited were written by the generator,
+// so they are ignored.
+func (t *SM) reloadDeferred() {
+	deferred := t.deferred
+	t.deferred = nil
+	for _, c := range deferred {
+		if c.path != "" {
+			info, err := os.Stat(c.path)
+			if err != nil || !info.ModTime().After(t.generatedAt) {
+				log.VV(t.prefix+"Ignoring change to %v made by generators", c.path)
+				continue
+			}
+		}
+		t.Reload(c.path, c.matchers...)
+	}
+}
@@ -0,0 +1,164 @@
+package task
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prashantv/autobld/config"
+	"github.com/prashantv/autobld/log"
+)
+
+// Environment variables that describe the lifecycle event to a hook.
+const (
+	envHook     = "AUTOBLD_HOOK"
+	envExitCode = "AUTOBLD_EXIT_CODE"
+)
+
+// Names of the lifecycle events that hooks are run for.
+const (
+	hookBeforeStart      = "beforeStart"
+	hookAfterStart       = "afterStart"
+	hookBeforeStop       = "beforeStop"
+	hookAfterStop        = "afterStop"
+	hookOnCrash          = "onCrash"
+	hookOnChangeDetected = "onChangeDetected"
+)
+
+// hookRun is a hook that is running in the background.
+type hookRun struct {
+	event string
+	task  *Task
+	// done is closed once the hook has exited, after which failed is valid.
+	done   chan struct{}
+	failed bool
+}
+
+// finished returns whether the hook has exited.
+func (r *hookRun) finished() bool {
+	select {
+	case <-r.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// startHook starts the hook for the given event in the background if it is configured,
+// and kills it if it does not exit within its timeout. The state machine is reprocessed
+// once the hook exits. changes are the changed files passed to the hook, and exited is
+// the task that exited for afterStop and onCrash hooks.
+func (t *SM) startHook(event string, h *config.Hook, changes []string, exited *Task) *hookRun {
+	if h == nil {
+		return nil
+	}
+	if !log.V(t.prefix+"Running %v hook: %v", event, h.Action) {
+		log.L(t.prefix+"Running %v hook", event)
+	}
+
+	env := append(t.loadEnv(),
+		envHook+"="+event,
+		envChangedFiles+"="+strings.Join(changes, string(os.PathListSeparator)),
+		envChangedCount+"="+strconv.Itoa(len(changes)),
+		envReloadSeq+"="+strconv.Itoa(t.reloadSeq),
+	)
+	if exited != nil {
+		env = append(env, envExitCode+"="+strconv.Itoa(exited.ExitCode()))
+	}
+	r := &hookRun{event: event, done: make(chan struct{})}
+	hook, err := New(Options{
+		Dir:    t.c.BaseDir,
+		Args:   h.Action,
+		Env:    env,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	})
+	if err != nil {
+		log.L(t.prefix+"Failed to run %v hook: %v", event, err)
+		r.failed = true
+		close(r.done)
+		return r
+	}
+	hook.stdinPipe.Close()
+	r.task = hook
+	t.hooks = append(t.runningHooks(), r)
+
+	go func() {
+		select {
+		case <-hook.exited:
+		case <-time.After(h.Timeout):
+			log.L(t.prefix+"Hook %v did not finish within %v, killing it", event, h.Timeout)
+			hook.Kill()
+			hook.Wait()
+		}
+		hook.KillSurvivors()
+		if !hook.Success() {
+			log.L(t.prefix+"Hook %v failed (%v)", event, hook.State())
+			r.failed = true
+		}
+		close(r.done)
+		t.Reprocess <- struct{}{}
+	}()
+	return r
+}
+
+// awaitHook starts the hook for event the first time it is called and stores it in *r,
+// and returns whether the hook has exited, so the state machine can wait for it without
+// blocking. Once it has exited, *r is cleared so the hook runs again next time, and abort
+// is whether it failed with AbortOnFailure set.
+func (t *SM) awaitHook(r **hookRun, event string, h *config.Hook, changes []string) (done, abort bool) {
+	if h == nil {
+		return true, false
+	}
+	if *r == nil {
+		*r = t.startHook(event, h, changes, nil)
+	}
+	if !(*r).finished() {
+		return false, false
+	}
+	failed := (*r).failed
+	*r = nil
+	return true, failed && h.AbortOnFailure
+}
+
+// runningHooks returns the hooks that have not exited yet.
+func (t *SM) runningHooks() []*hookRun {
+	var running []*hookRun
+	for _, r := range t.hooks {
+		if !r.finished() {
+			running = append(running, r)
+		}
+	}
+	return running
+}
+
+// killHooks kills any hooks that are still running.
+func (t *SM) killHooks() {
+	for _, r := range t.runningHooks() {
+		log.V(t.prefix+"Killing %v hook as autobld is exiting", r.event)
+		r.task.Kill()
+		<-r.done
+	}
+}
+
+// waitHooks blocks till all hooks have exited, or have been killed after their timeout.
+func (t *SM) waitHooks() {
+	for _, r := range t.runningHooks() {
+		<-r.done
+	}
+}
+
+// isServer returns whether task is the long-running server, rather than a build step.
+func (t *SM) isServer(task *Task) bool {
+	return task == t.server || (task == t.Task && t.isLastStep())
+}
+
+// stopped is called once a task that was stopped has exited. It kills any processes
+// that are still running, and runs the afterStop hook if the task is the server.
+func (t *SM) stopped(task *Task) {
+	t.killSurvivors(task)
+	if t.isServer(task) && !task.stopSent.IsZero() {
+		t.startHook(hookAfterStop, t.c.Hooks.AfterStop, t.changes, task)
+	}
+}
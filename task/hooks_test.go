@@ -0,0 +1,97 @@
+// +build !windows
+
+package task
+
+import (
+	"testing"
+
+	"github.com/prashantv/autobld/config"
+)
+
+// failingHook returns a hook that always fails.
+func failingHook(abortOnFailure bool) *config.Hook {
+	return &config.Hook{
+		Step:           config.Step{Name: "hook", Action: []string{"sh", "-c", "exit 1"}},
+		Timeout:        smTimeout,
+		AbortOnFailure: abortOnFailure,
+	}
+}
+
+func TestBeforeStartAbort(t *testing.T) {
+	tests := []struct {
+		msg            string
+		abortOnFailure bool
+		wantStarted    bool
+	}{
+		{
+			msg:         "failure is ignored",
+			wantStarted: true,
+		},
+		{
+			msg:            "failure aborts the start",
+			abortOnFailure: true,
+		},
+	}
+
+	for _, tt := range tests {
+		c := shellTask("exec sleep 60")
+		c.Hooks.BeforeStart = failingHook(tt.abortOnFailure)
+		sm := newTestSM(c)
+
+		if !runSM(t, sm, func() bool { return sm.Running() || sm.startErr != nil }) {
+			t.Fatalf("%v: beforeStart hook did not finish: %v", tt.msg, sm.Status())
+		}
+		if got := sm.Running(); got != tt.wantStarted {
+			t.Errorf("%v: task started got %v, want %v", tt.msg, got, tt.wantStarted)
+		}
+		if !tt.wantStarted {
+			if finished, exitCode := sm.Finished(0); !finished || exitCode != 1 {
+				t.Errorf("%v: Finished got (%v, %v), want (true, 1)", tt.msg, finished, exitCode)
+			}
+			if sm.blocked {
+				t.Errorf("%v: proxies are still blocked after the start was aborted", tt.msg)
+			}
+		}
+		closeTestSM(sm)
+	}
+}
+
+func TestOnChangeDetectedAbort(t *testing.T) {
+	tests := []struct {
+		msg            string
+		abortOnFailure bool
+		wantRestarted  bool
+	}{
+		{
+			msg:           "failure is ignored",
+			wantRestarted: true,
+		},
+		{
+			msg:            "failure aborts the restart",
+			abortOnFailure: true,
+		},
+	}
+
+	for _, tt := range tests {
+		c := shellTask("exec sleep 60")
+		c.Hooks.OnChangeDetected = failingHook(tt.abortOnFailure)
+		sm := newTestSM(c)
+
+		if !runSM(t, sm, sm.Ready) {
+			t.Fatalf("%v: task is not ready: %v", tt.msg, sm.Status())
+		}
+		first := sm.Task
+
+		sm.Reload("changed.go")
+		if !runSM(t, sm, func() bool { return sm.changeHook == nil && sm.Ready() }) {
+			t.Fatalf("%v: onChangeDetected hook did not finish: %v", tt.msg, sm.Status())
+		}
+		if got := sm.Task != first; got != tt.wantRestarted {
+			t.Errorf("%v: task restarted got %v, want %v", tt.msg, got, tt.wantRestarted)
+		}
+		if got := first.Exited(); got != tt.wantRestarted {
+			t.Errorf("%v: previous task stopped got %v, want %v", tt.msg, got, tt.wantRestarted)
+		}
+		closeTestSM(sm)
+	}
+}
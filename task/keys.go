@@ -0,0 +1,115 @@
+package task
+
+import (
+	"os"
+	"sync"
+
+	"github.com/prashantv/autobld/log"
+)
+
+// Command is a keyboard command typed on stdin after the prefix key.
+type Command int
+
+// List of keyboard commands.
+const (
+	CommandRestart Command = iota + 1
+	CommandPause
+	CommandVerbose
+	CommandClear
+	CommandStatus
+	CommandQuit
+	CommandHelp
+)
+
+// commandKeys maps the key typed after the prefix key to its command.
+var commandKeys = map[byte]Command{
+	'r': CommandRestart,
+	'p': CommandPause,
+	'v': CommandVerbose,
+	'c': CommandClear,
+	's': CommandStatus,
+	'q': CommandQuit,
+	'h': CommandHelp,
+	'?': CommandHelp,
+}
+
+// CommandsHelp describes the keys for each command.
+const CommandsHelp = "r: restart, p: pause/resume watching, v: toggle verbosity, c: clear screen, s: status, q: quit"
+
+// commandFilter removes keyboard commands from stdin before it is copied to the task.
+type commandFilter struct {
+	prefix   byte
+	commands chan Command
+	// pending is set when the last key was the prefix key.
+	pending bool
+}
+
+var (
+	commandsMu sync.Mutex
+	commands   *commandFilter
+)
+
+// EnableCommands handles keyboard commands typed on stdin after the prefix key,
+// and returns the channel that commands are sent to. All other input is still sent
+// to the task. The returned function restores the terminal, and should be called
+// before autobld exits.
+func EnableCommands(prefix byte) (<-chan Command, func()) {
+	f := &commandFilter{
+		prefix:   prefix,
+		commands: make(chan Command, 10),
+	}
+	commandsMu.Lock()
+	commands = f
+	commandsMu.Unlock()
+	return f.commands, setCbreak(os.Stdin)
+}
+
+// commandsEnabled returns whether keyboard commands are enabled.
+func commandsEnabled() bool {
+	commandsMu.Lock()
+	defer commandsMu.Unlock()
+	return commands != nil
+}
+
+// filterCommands returns data without any keyboard commands, if they are enabled.
+func filterCommands(data []byte) []byte {
+	commandsMu.Lock()
+	f := commands
+	commandsMu.Unlock()
+	if f == nil {
+		return data
+	}
+	return f.filter(data)
+}
+
+func (f *commandFilter) filter(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	for _, b := range data {
+		switch {
+		case f.pending:
+			f.pending = false
+			if b == f.prefix {
+				// The prefix key typed twice is sent to the task.
+				out = append(out, b)
+			} else if cmd, ok := commandKeys[b]; ok {
+				f.send(cmd)
+			} else {
+				log.L("Unknown command key %q (%v)", b, CommandsHelp)
+			}
+		case b == f.prefix:
+			f.pending = true
+		default:
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// send sends cmd without blocking, so Stdin is still read if commands are not being handled.
+func (f *commandFilter) send(cmd Command) {
+	select {
+	case f.commands <- cmd:
+	default:
+		log.L("Ignoring command as too many commands are pending")
+	}
+}
@@ -0,0 +1,75 @@
+package task
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCommandFilter(t *testing.T) {
+	const prefix = 0x14 // ctrl-t
+
+	tests := []struct {
+		msg    string
+		writes []string
+		want   string
+		cmds   []Command
+	}{
+		{
+			msg:    "no commands",
+			writes: []string{"hello\n"},
+			want:   "hello\n",
+		},
+		{
+			msg:    "command",
+			writes: []string{"a\x14rb"},
+			want:   "ab",
+			cmds:   []Command{CommandRestart},
+		},
+		{
+			msg:    "multiple commands",
+			writes: []string{"\x14s\x14q"},
+			cmds:   []Command{CommandStatus, CommandQuit},
+		},
+		{
+			msg:    "prefix and key in separate reads",
+			writes: []string{"a\x14", "pb"},
+			want:   "ab",
+			cmds:   []Command{CommandPause},
+		},
+		{
+			msg:    "prefix typed twice",
+			writes: []string{"\x14\x14x"},
+			want:   "\x14x",
+		},
+		{
+			msg:    "unknown command key",
+			writes: []string{"\x14zx"},
+			want:   "x",
+		},
+		{
+			msg:    "help",
+			writes: []string{"\x14h\x14?"},
+			cmds:   []Command{CommandHelp, CommandHelp},
+		},
+	}
+
+	for _, tt := range tests {
+		f := &commandFilter{prefix: prefix, commands: make(chan Command, 10)}
+		var got []byte
+		for _, w := range tt.writes {
+			got = append(got, f.filter([]byte(w))...)
+		}
+		close(f.commands)
+		var cmds []Command
+		for cmd := range f.commands {
+			cmds = append(cmds, cmd)
+		}
+
+		if string(got) != tt.want {
+			t.Errorf("%v: filter got %q, want %q", tt.msg, got, tt.want)
+		}
+		if !reflect.DeepEqual(cmds, tt.cmds) {
+			t.Errorf("%v: filter got commands %v, want %v", tt.msg, cmds, tt.cmds)
+		}
+	}
+}
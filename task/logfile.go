@@ -0,0 +1,130 @@
+package task
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prashantv/autobld/config"
+	"github.com/prashantv/autobld/log"
+)
+
+// logFile is an output file which is rotated once it reaches the configured MaxSize.
+type logFile struct {
+	sync.Mutex
+	c    config.Output
+	path string
+	f    *os.File
+	size int64
+}
+
+// openLogFile opens the output file at path. The file is truncated if truncate is set,
+// unless Append is set. If PerRun is set, runStart is added to the file name, so every
+// run is written to a new file.
+func openLogFile(path string, c config.Output, runStart time.Time, truncate bool) (*logFile, error) {
+	if c.PerRun {
+		runPath := perRunPath(path, runStart)
+		removeOldRuns(path, runPath, c.MaxFiles)
+		path = runPath
+	}
+
+	l := &logFile{c: c, path: path}
+	if err := l.open(truncate && !c.Append); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *logFile) open(truncate bool) error {
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if truncate {
+		flags |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(l.path, flags, 0666)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.f = f
+	l.size = info.Size()
+	return nil
+}
+
+func (l *logFile) Write(p []byte) (int, error) {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.c.MaxSize > 0 && l.size > 0 && l.size+int64(len(p)) > int64(l.c.MaxSize) {
+		if err := l.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := l.f.Write(p)
+	l.size += int64(n)
+	return n, err
+}
+
+// Close closes the underlying file.
+func (l *logFile) Close() error {
+	l.Lock()
+	defer l.Unlock()
+	return l.f.Close()
+}
+
+// rotate renames path to path.1 (and path.1 to path.2, etc), keeping MaxFiles
+// rotated files, and then opens a new file at path.
+func (l *logFile) rotate() error {
+	log.VV("Rotating output file %v", l.path)
+	l.f.Close()
+
+	os.Remove(fmt.Sprintf("%v.%v", l.path, l.c.MaxFiles))
+	for i := l.c.MaxFiles - 1; i > 0; i-- {
+		os.Rename(fmt.Sprintf("%v.%v", l.path, i), fmt.Sprintf("%v.%v", l.path, i+1))
+	}
+	if err := os.Rename(l.path, l.path+".1"); err != nil {
+		log.L("Failed to rotate output file: %v", err)
+	}
+	return l.open(true /* truncate */)
+}
+
+// runTimeFormat is the format of the run's start time added to per-run file names.
+// It has microseconds, so runs that start within the same second use different files,
+// and it is a fixed width, so sorting the file names sorts the runs.
+const runTimeFormat = "20060102-150405.000000"
+
+// perRunPath adds the run's start time to the file name, before the extension.
+func perRunPath(path string, runStart time.Time) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + runStart.Format(runTimeFormat) + ext
+}
+
+// removeOldRuns removes old per-run files for path, so that there are maxFiles files
+// including runPath.
+func removeOldRuns(path, runPath string, maxFiles int) {
+	ext := filepath.Ext(path)
+	matches, err := filepath.Glob(strings.TrimSuffix(path, ext) + "-????????-??????.??????" + ext)
+	if err != nil {
+		return
+	}
+
+	var old []string
+	for _, m := range matches {
+		if m != runPath {
+			old = append(old, m)
+		}
+	}
+	sort.Strings(old)
+	for len(old) >= maxFiles {
+		log.VV("Removing old output file %v", old[0])
+		os.Remove(old[0])
+		old = old[1:]
+	}
+}
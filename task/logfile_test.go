@@ -0,0 +1,143 @@
+package task
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prashantv/autobld/config"
+)
+
+func TestLogFileRotate(t *testing.T) {
+	tests := []struct {
+		msg      string
+		maxFiles int
+		writes   []string
+		// want maps the file suffix ("" for the current file) to its contents.
+		want map[string]string
+	}{
+		{
+			msg:      "no rotation",
+			maxFiles: 2,
+			writes:   []string{"aaaa", "bbbb"},
+			want:     map[string]string{"": "aaaabbbb"},
+		},
+		{
+			msg:      "rotate once",
+			maxFiles: 2,
+			writes:   []string{"aaaa", "bbbb", "cccc"},
+			want:     map[string]string{"": "cccc", ".1": "aaaabbbb"},
+		},
+		{
+			msg:      "keeps maxFiles rotated files",
+			maxFiles: 2,
+			writes:   []string{"aaaaaaaa", "bbbbbbbb", "cccccccc", "dddddddd"},
+			want:     map[string]string{"": "dddddddd", ".1": "cccccccc", ".2": "bbbbbbbb"},
+		},
+		{
+			msg:      "write larger than max size",
+			maxFiles: 1,
+			writes:   []string{"aaaaaaaaaaaa", "b"},
+			want:     map[string]string{"": "b", ".1": "aaaaaaaaaaaa"},
+		},
+	}
+
+	for _, tt := range tests {
+		dir, err := ioutil.TempDir("", "autobld-logfile")
+		if err != nil {
+			t.Fatalf("TempDir failed: %v", err)
+		}
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "out.log")
+		c := config.Output{MaxSize: 8, MaxFiles: tt.maxFiles}
+		l, err := openLogFile(path, c, time.Now(), true /* truncate */)
+		if err != nil {
+			t.Fatalf("%v: openLogFile failed: %v", tt.msg, err)
+		}
+		for _, w := range tt.writes {
+			if _, err := l.Write([]byte(w)); err != nil {
+				t.Errorf("%v: Write failed: %v", tt.msg, err)
+			}
+		}
+		l.Close()
+
+		got := make(map[string]string)
+		files, _ := filepath.Glob(path + "*")
+		for _, f := range files {
+			contents, err := ioutil.ReadFile(f)
+			if err != nil {
+				t.Errorf("%v: ReadFile failed: %v", tt.msg, err)
+			}
+			got[f[len(path):]] = string(contents)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: rotated files got %v, want %v", tt.msg, got, tt.want)
+		}
+	}
+}
+
+func TestLogFilePerRun(t *testing.T) {
+	tests := []struct {
+		msg      string
+		file     string
+		maxFiles int
+		runs     int
+		want     int
+	}{
+		{
+			msg:      "runs in the same second",
+			file:     "out.log",
+			maxFiles: 5,
+			runs:     3,
+			want:     3,
+		},
+		{
+			msg:      "keeps maxFiles runs",
+			file:     "out.log",
+			maxFiles: 2,
+			runs:     4,
+			want:     2,
+		},
+		{
+			msg:      "no extension",
+			file:     "out",
+			maxFiles: 2,
+			runs:     4,
+			want:     2,
+		},
+	}
+
+	start := time.Date(2016, 1, 2, 15, 4, 5, 0, time.Local)
+	for _, tt := range tests {
+		dir, err := ioutil.TempDir("", "autobld-logfile")
+		if err != nil {
+			t.Fatalf("TempDir failed: %v", err)
+		}
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, tt.file)
+		c := config.Output{PerRun: true, MaxFiles: tt.maxFiles}
+		var last string
+		for i := 0; i < tt.runs; i++ {
+			runStart := start.Add(time.Duration(i) * time.Millisecond)
+			l, err := openLogFile(path, c, runStart, true /* truncate */)
+			if err != nil {
+				t.Fatalf("%v: openLogFile failed: %v", tt.msg, err)
+			}
+			l.Close()
+			last = l.path
+		}
+
+		files, _ := filepath.Glob(filepath.Join(dir, "*"))
+		if len(files) != tt.want {
+			t.Errorf("%v: per-run files got %v, want %v files", tt.msg, files, tt.want)
+		}
+		if len(files) > 0 && files[len(files)-1] != last {
+			t.Errorf("%v: newest file got %v, want %v", tt.msg, files[len(files)-1], last)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package task
+
+import (
+	"time"
+
+	"github.com/prashantv/autobld/config"
+	"github.com/prashantv/autobld/log"
+)
+
+// oneshot returns whether every run of the task runs to completion,
+// rather than the last step being a long-running server.
+func (t *SM) oneshot() bool {
+	return t.c.Mode == config.ModeOneshot
+}
+
+// runDuration returns how long the current run has been running.
+func (t *SM) runDuration() time.Duration {
+	return time.Since(t.runStart).Round(time.Millisecond)
+}
+
+// reportRun logs the summary line for a one-shot run once the current step has exited.
+// A run passes if every step succeeded.
+func (t *SM) reportRun() {
+	state := t.Task.State()
+	if !t.isLastStep() {
+		state = t.steps[t.step].Name + ": " + state
+	}
+	if t.Task.Success() && t.isLastStep() {
+		log.L(t.prefix+"PASS (%v) in %v", state, t.runDuration())
+		return
+	}
+	log.L(t.prefix+"FAIL (%v) in %v", state, t.runDuration())
+}
+
+// finishRun reports a one-shot run that had not been reported when a change
+// was detected: either it was stopped, or it completed during the change timeout.
+func (t *SM) finishRun() {
+	switch {
+	case t.Task == nil || t.exitHandled || t.failed:
+		return
+	case !t.Task.stopSent.IsZero():
+		log.L(t.prefix+"CANCELLED after %v", t.runDuration())
+	case t.isLastStep() || !t.Task.Success():
+		t.reportRun()
+	}
+}
@@ -0,0 +1,58 @@
+// +build !windows
+
+package task
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prashantv/autobld/config"
+)
+
+func TestOneshotCancel(t *testing.T) {
+	tests := []struct {
+		msg           string
+		cmd           string
+		changeTimeout time.Duration
+		wantCancelled bool
+	}{
+		{
+			msg:           "run is cancelled",
+			cmd:           "exec sleep 60",
+			changeTimeout: 10 * time.Millisecond,
+			wantCancelled: true,
+		},
+		{
+			msg:           "run completes during the change timeout",
+			cmd:           "exec sleep 0.05",
+			changeTimeout: 200 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		c := shellTask(tt.cmd)
+		c.Mode = config.ModeOneshot
+		c.ChangeTimeout = tt.changeTimeout
+		sm := newTestSM(c)
+
+		if !runSM(t, sm, sm.Running) {
+			t.Fatalf("%v: run did not start: %v", tt.msg, sm.Status())
+		}
+		first := sm.Task
+
+		sm.Reload("")
+		if !runSM(t, sm, func() bool { return sm.Running() && sm.Task != first }) {
+			t.Errorf("%v: next run did not start: %v", tt.msg, sm.Status())
+		}
+		if !first.Exited() {
+			t.Errorf("%v: previous run is still running", tt.msg)
+		}
+		if got := !first.stopSent.IsZero(); got != tt.wantCancelled {
+			t.Errorf("%v: previous run cancelled got %v, want %v", tt.msg, got, tt.wantCancelled)
+		}
+		if sm.Ready() {
+			t.Errorf("%v: task is ready while the next run is running", tt.msg)
+		}
+		closeTestSM(sm)
+	}
+}
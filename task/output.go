@@ -0,0 +1,79 @@
+package task
+
+import (
+	"io"
+	"os"
+
+	"github.com/prashantv/autobld/config"
+)
+
+// output holds the writers for a task's STDOUT and STDERR.
+type output struct {
+	stdout  io.Writer
+	stderr  io.Writer
+	closers []io.Closer
+	// terminal is shared by the line writers that write to the terminal.
+	terminal sharedLines
+}
+
+// getOutFile returns the writer for a stream of the task's output, which writes to the
+// terminal (defaultFile) and/or confFile. stream is the name used in the output prefix.
+func (o *output) getOutFile(c *config.Task, stream, confFile string, defaultFile *os.File, r run) (io.Writer, error) {
+	oc := c.Output
+	type dest struct {
+		w        io.Writer
+		terminal bool
+	}
+	var dests []dest
+	if confFile == "" || oc.Tee {
+		dests = append(dests, dest{defaultFile, true})
+	}
+	if confFile != "" {
+		l, err := openLogFile(confFile, oc, r.start, r.first)
+		if err != nil {
+			return nil, err
+		}
+		o.closers = append(o.closers, l)
+		if oc.MaxSize == 0 {
+			// Use the file directly, so the task writes to it without a pipe.
+			dests = append(dests, dest{l.f, false})
+		} else {
+			dests = append(dests, dest{l, false})
+		}
+	}
+
+	writers := make([]io.Writer, len(dests))
+	for i, d := range dests {
+		color := oc.Color && d.terminal
+		if oc.Banner && r.first && stream == "out" {
+			writeBanner(d.w, r, color)
+		}
+		writers[i] = d.w
+		if oc.LineProcessing() {
+			lw := &lineWriter{w: d.w, prefix: newLinePrefix(oc.Prefix, oc.Timestamps, color, r, stream)}
+			if d.terminal {
+				lw.shared = &o.terminal
+			}
+			writers[i] = lw
+		}
+	}
+	if len(writers) == 1 {
+		return writers[0], nil
+	}
+	return io.MultiWriter(writers...), nil
+}
+
+// newOutput opens the configured output files for the task. The files are truncated
+// for the first step of a run, unless output.append is set.
+func newOutput(c *config.Task, r run) (*output, error) {
+	o := &output{}
+	var err error
+	if o.stdout, err = o.getOutFile(c, "out", c.StdOut, os.Stdout, r); err != nil {
+		return nil, err
+	}
+	if o.stderr, err = o.getOutFile(c, "err", c.StdErr, os.Stderr, r); err != nil {
+		closeAll(o.closers)
+		return nil, err
+	}
+	return o, nil
+}
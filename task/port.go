@@ -0,0 +1,87 @@
+package task
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/prashantv/autobld/log"
+)
+
+// portPollInterval is how often the forwardTo ports are checked while waiting for them to be released.
+const portPollInterval = 100 * time.Millisecond
+
+// portInUse returns whether something is still listening on the given port. Errors other
+// than the address being in use (such as not having permission to listen on the port)
+// are returned, as waiting will not help.
+func portInUse(port int) (bool, error) {
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%v", port))
+	if err != nil {
+		if isAddrInUse(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	ln.Close()
+	return false, nil
+}
+
+// busyPort returns the first forwardTo port of the task's proxies that is still in use, or 0.
+func (t *SM) busyPort() (int, error) {
+	for _, pc := range t.c.ProxyConfigs {
+		inUse, err := portInUse(pc.ForwardTo)
+		if err != nil {
+			return 0, fmt.Errorf("cannot check whether port %v is in use: %v", pc.ForwardTo, err)
+		}
+		if inUse {
+			return pc.ForwardTo, nil
+		}
+	}
+	return 0, nil
+}
+
+// portsFree returns whether the server can be started, as all the proxies' forwardTo
+// ports have been released by the previous server. If a port is still in use after
+// the port timeout, the task is not started till the next change.
+func (t *SM) portsFree() bool {
+	port, err := t.busyPort()
+	if err != nil {
+		t.cannotStart(err)
+		return false
+	}
+	if port == 0 {
+		t.portWait = time.Time{}
+		return true
+	}
+
+	if t.portWait.IsZero() {
+		log.L(t.prefix+"Waiting for port %v to be released%v", port, portOwnerDesc(port))
+		t.portWait = time.Now()
+		go t.reprocessFor(t.c.PortTimeout, portPollInterval)
+		return false
+	}
+	if time.Since(t.portWait) < t.c.PortTimeout {
+		return false
+	}
+
+	t.cannotStart(fmt.Errorf("port %v is still in use%v after %v", port, portOwnerDesc(port), t.c.PortTimeout))
+	return false
+}
+
+// portOwnerDesc returns a description of the processes listening on port for logs, if they are known.
+func portOwnerDesc(port int) string {
+	owners := portOwners(port)
+	if len(owners) == 0 {
+		return ""
+	}
+	return " by " + strings.Join(owners, ", ")
+}
+
+// reprocessFor is a goroutine that triggers a reprocess every interval till d has passed.
+func (t *SM) reprocessFor(d, interval time.Duration) {
+	for deadline := time.Now().Add(d); time.Now().Before(deadline); {
+		time.Sleep(interval)
+		t.Reprocess <- struct{}{}
+	}
+}
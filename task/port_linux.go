@@ -0,0 +1,64 @@
+package task
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// tcpListen is the state of a listening socket in /proc/net/tcp.
+const tcpListen = "0A"
+
+// portOwners returns descriptions of the processes with a socket listening on port,
+// found using /proc/net/tcp and each process's file descriptors.
+func portOwners(port int) []string {
+	sockets := make(map[string]bool)
+	for _, file := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		// Each line has the fields: sl local_address rem_address st ... inode
+		for _, line := range strings.Split(string(data), "\n")[1:] {
+			fields := strings.Fields(line)
+			if len(fields) < 10 || fields[3] != tcpListen {
+				continue
+			}
+			local := fields[1]
+			p, err := strconv.ParseInt(local[strings.LastIndex(local, ":")+1:], 16, 32)
+			if err != nil || int(p) != port {
+				continue
+			}
+			sockets["socket:["+fields[9]+"]"] = true
+		}
+	}
+	if len(sockets) == 0 {
+		return nil
+	}
+
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+	var pids []int
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		fdDir := fmt.Sprintf("/proc/%v/fd", pid)
+		fds, err := ioutil.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			if link, err := os.Readlink(fdDir + "/" + fd.Name()); err == nil && sockets[link] {
+				pids = append(pids, pid)
+				break
+			}
+		}
+	}
+	return describe(pids)
+}
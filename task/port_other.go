@@ -0,0 +1,8 @@
+// +build !linux
+
+package task
+
+// portOwners is only supported on Linux, where /proc/net/tcp is available.
+func portOwners(port int) []string {
+	return nil
+}
@@ -0,0 +1,25 @@
+package task
+
+import (
+	"net"
+	"testing"
+)
+
+func TestPortInUse(t *testing.T) {
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	if inUse, err := portInUse(port); err != nil || !inUse {
+		t.Errorf("portInUse(%v) while listening got (%v, %v), want (true, nil)", port, inUse, err)
+	}
+	ln.Close()
+	if inUse, err := portInUse(port); err != nil || inUse {
+		t.Errorf("portInUse(%v) after close got (%v, %v), want (false, nil)", port, inUse, err)
+	}
+	if _, err := portInUse(-1); err == nil {
+		t.Errorf("portInUse(-1) got no error, want error")
+	}
+}
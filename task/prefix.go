@@ -0,0 +1,152 @@
+package task
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ANSI color codes used for prefixes and banners.
+const (
+	colorReset = "\x1b[0m"
+	colorDim   = "\x1b[2m"
+	colorRed   = "\x1b[31m"
+	colorBold  = "\x1b[1m"
+)
+
+// taskColors are the colors used for task prefixes, picked by the task name.
+var taskColors = []string{
+	"\x1b[36m", // cyan
+	"\x1b[32m", // green
+	"\x1b[33m", // yellow
+	"\x1b[34m", // blue
+	"\x1b[35m", // magenta
+}
+
+// Placeholders that can be used in the output prefix.
+const (
+	prefixTask   = "{task}"
+	prefixRun    = "{run}"
+	prefixStep   = "{step}"
+	prefixStream = "{stream}"
+)
+
+const timestampFormat = "15:04:05.000"
+
+// run describes the current run of the task, which is used for output files and prefixes.
+type run struct {
+	task    string
+	seq     int
+	step    string
+	start   time.Time
+	changes []string
+	// first is whether this is the first step of the run.
+	first bool
+}
+
+func taskColor(name string) string {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return taskColors[h.Sum32()%uint32(len(taskColors))]
+}
+
+// sharedLines is shared by the lineWriters for STDOUT and STDERR that write to the
+// terminal, so that a partial line from one is ended before the other writes.
+type sharedLines struct {
+	sync.Mutex
+	last *lineWriter
+}
+
+// lineWriter prepends a prefix to every line written to w. Partial lines are written
+// immediately, and the prefix for the next line is written once it starts.
+type lineWriter struct {
+	w       io.Writer
+	prefix  func() string
+	midLine bool
+	shared  *sharedLines
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	var buf bytes.Buffer
+	if w.shared != nil {
+		w.shared.Lock()
+		defer w.shared.Unlock()
+		if last := w.shared.last; last != nil && last != w && last.midLine {
+			buf.WriteByte('\n')
+			last.midLine = false
+		}
+		w.shared.last = w
+	}
+	for len(p) > 0 {
+		if !w.midLine {
+			buf.WriteString(w.prefix())
+			w.midLine = true
+		}
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			buf.Write(p)
+			break
+		}
+		buf.Write(p[:i+1])
+		p = p[i+1:]
+		w.midLine = false
+	}
+	if _, err := w.w.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// newLinePrefix returns a function that returns the prefix for a line of output.
+func newLinePrefix(prefix string, timestamps, color bool, r run, stream string) func() string {
+	prefix = strings.NewReplacer(
+		prefixTask, r.task,
+		prefixRun, strconv.Itoa(r.seq+1),
+		prefixStep, r.step,
+		prefixStream, stream,
+	).Replace(prefix)
+	if color && prefix != "" {
+		c := taskColor(r.task)
+		if stream == "err" {
+			c = colorRed
+		}
+		prefix = c + prefix + colorReset
+	}
+
+	return func() string {
+		if !timestamps {
+			return prefix
+		}
+		ts := time.Now().Format(timestampFormat) + " "
+		if color {
+			ts = colorDim + ts + colorReset
+		}
+		return ts + prefix
+	}
+}
+
+// writeBanner writes a separator line before the output for a run.
+func writeBanner(w io.Writer, r run, color bool) {
+	name := ""
+	if r.task != "" {
+		name = "[" + r.task + "] "
+	}
+	changes := ""
+	switch n := len(r.changes); {
+	case n > 3:
+		changes = fmt.Sprintf(" (changed %v and %v more)", strings.Join(r.changes[:3], ", "), n-3)
+	case n > 0:
+		changes = fmt.Sprintf(" (changed %v)", strings.Join(r.changes, ", "))
+	}
+	banner := fmt.Sprintf("==== %vRun %v started at %v%v ====", name, r.seq+1, r.start.Format("15:04:05"), changes)
+	if color {
+		banner = colorBold + taskColor(r.task) + banner + colorReset
+	}
+	fmt.Fprintln(w, banner)
+}
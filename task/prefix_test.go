@@ -0,0 +1,70 @@
+package task
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLineWriter(t *testing.T) {
+	tests := []struct {
+		msg    string
+		writes []string
+		want   string
+	}{
+		{
+			msg:    "single line",
+			writes: []string{"hello\n"},
+			want:   "> hello\n",
+		},
+		{
+			msg:    "multiple lines in one write",
+			writes: []string{"a\nb\nc\n"},
+			want:   "> a\n> b\n> c\n",
+		},
+		{
+			msg:    "partial lines",
+			writes: []string{"hel", "lo\nwor", "ld\n"},
+			want:   "> hello\n> world\n",
+		},
+		{
+			msg:    "prefix is not written until the next line starts",
+			writes: []string{"a\n", "", "b"},
+			want:   "> a\n> b",
+		},
+		{
+			msg:    "empty lines",
+			writes: []string{"\n\n"},
+			want:   "> \n> \n",
+		},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		w := &lineWriter{w: &buf, prefix: func() string { return "> " }}
+		for _, s := range tt.writes {
+			if n, err := w.Write([]byte(s)); err != nil || n != len(s) {
+				t.Errorf("%v: Write(%q) got (%v, %v), want (%v, nil)", tt.msg, s, n, err, len(s))
+			}
+		}
+		if got := buf.String(); got != tt.want {
+			t.Errorf("%v: lineWriter got %q, want %q", tt.msg, got, tt.want)
+		}
+	}
+}
+
+func TestLineWriterShared(t *testing.T) {
+	var buf bytes.Buffer
+	shared := &sharedLines{}
+	out := &lineWriter{w: &buf, prefix: func() string { return "out| " }, shared: shared}
+	errw := &lineWriter{w: &buf, prefix: func() string { return "err| " }, shared: shared}
+
+	out.Write([]byte("partial"))
+	errw.Write([]byte("error\n"))
+	out.Write([]byte("more\n"))
+
+	// The partial line is ended before the other writer writes, and continues with a new prefix.
+	want := "out| partial\nerr| error\nout| more\n"
+	if got := buf.String(); got != want {
+		t.Errorf("shared lineWriters got %q, want %q", got, want)
+	}
+}
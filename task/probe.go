@@ -0,0 +1,134 @@
+package task
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/prashantv/autobld/config"
+)
+
+// probe checks whether a task is ready, and stores the result once it completes.
+type probe struct {
+	c *config.Probe
+	// started is the time the task was started.
+	started time.Time
+	// matched is closed once the task's STDOUT matches the configured pattern.
+	matched chan struct{}
+
+	// done is closed once the probe completes, after which err is valid.
+	done chan struct{}
+	err  error
+}
+
+func newProbe(c *config.Probe) *probe {
+	return &probe{
+		c:       c,
+		started: time.Now(),
+		matched: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// finished returns whether the probe has completed.
+func (p *probe) finished() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// run checks the probe every interval till it succeeds, the task exits, or the probe times out.
+func (p *probe) run(exited <-chan struct{}) {
+	defer close(p.done)
+
+	timeout := time.After(p.c.Timeout)
+	for !p.check() {
+		select {
+		case <-p.matched:
+			return
+		case <-exited:
+			p.err = errors.New("task exited before it was ready")
+			return
+		case <-timeout:
+			p.err = fmt.Errorf("readiness probe timed out after %v", p.c.Timeout)
+			return
+		case <-time.After(p.c.Interval):
+		}
+	}
+}
+
+// check returns whether the task is ready. STDOUT matches are handled by run.
+func (p *probe) check() bool {
+	switch {
+	case p.c.TCP != "":
+		conn, err := net.DialTimeout("tcp", p.c.TCP, p.c.Interval)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	case p.c.HTTP != "":
+		client := http.Client{Timeout: p.c.Interval}
+		resp, err := client.Get(p.c.HTTP)
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == p.c.Status
+	case p.c.File != "":
+		info, err := os.Stat(p.c.File)
+		return err == nil && !info.ModTime().Before(p.started)
+	}
+	return false
+}
+
+// maxLineSize is the maximum length of a line that is matched. Longer lines are truncated.
+const maxLineSize = 64 * 1024
+
+// regexpWriter is an io.Writer that closes matched once a line matches the regexp.
+type regexpWriter struct {
+	sync.Mutex
+	re      *regexp.Regexp
+	matched chan struct{}
+	line    []byte
+	done    bool
+}
+
+func (w *regexpWriter) Write(p []byte) (int, error) {
+	w.Lock()
+	defer w.Unlock()
+
+	n := len(p)
+	for !w.done && len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			w.append(p)
+			break
+		}
+
+		w.append(p[:i])
+		if w.re.Match(w.line) {
+			w.done = true
+			close(w.matched)
+		}
+		w.line = w.line[:0]
+		p = p[i+1:]
+	}
+	return n, nil
+}
+
+func (w *regexpWriter) append(p []byte) {
+	if remaining := maxLineSize - len(w.line); len(p) > remaining {
+		p = p[:remaining]
+	}
+	w.line = append(w.line, p...)
+}
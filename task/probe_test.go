@@ -0,0 +1,91 @@
+// +build !windows
+
+package task
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prashantv/autobld/config"
+)
+
+func TestProbeRun(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "ready")
+
+	tests := []struct {
+		msg     string
+		created bool
+		exited  bool
+		wantErr string
+	}{
+		{
+			msg:     "file created",
+			created: true,
+		},
+		{
+			msg:     "task exited",
+			exited:  true,
+			wantErr: "task exited before it was ready",
+		},
+		{
+			msg:     "timed out",
+			wantErr: "readiness probe timed out after 50ms",
+		},
+	}
+
+	for _, tt := range tests {
+		os.Remove(file)
+		p := newProbe(&config.Probe{File: file, Timeout: 50 * time.Millisecond, Interval: 10 * time.Millisecond})
+		exited := make(chan struct{})
+		if tt.exited {
+			close(exited)
+		}
+		if tt.created {
+			if err := ioutil.WriteFile(file, nil, 0666); err != nil {
+				t.Fatalf("WriteFile failed: %v", err)
+			}
+			// File times may be slightly behind time.Now, so make sure the file is newer
+			// than the probe's start.
+			later := time.Now().Add(time.Second)
+			os.Chtimes(file, later, later)
+		}
+		p.run(exited)
+
+		var gotErr string
+		if p.err != nil {
+			gotErr = p.err.Error()
+		}
+		if gotErr != tt.wantErr {
+			t.Errorf("%v: probe error got %q, want %q", tt.msg, gotErr, tt.wantErr)
+		}
+	}
+}
+
+func TestProbeTimeoutFailsStart(t *testing.T) {
+	c := shellTask("exec sleep 60")
+	c.Ready = stdoutProbe("never printed")
+	c.Ready.Timeout = 50 * time.Millisecond
+	sm := newTestSM(c)
+	defer closeTestSM(sm)
+
+	if !runSM(t, sm, func() bool { return sm.probe == nil && sm.Task != nil }) {
+		t.Fatalf("readiness probe did not finish: %v", sm.Status())
+	}
+	if !sm.Running() {
+		t.Errorf("task was stopped after it failed its readiness probe")
+	}
+	if sm.Ready() {
+		t.Errorf("task is ready after it failed its readiness probe")
+	}
+	if finished, exitCode := sm.Finished(0); !finished || exitCode != 1 {
+		t.Errorf("Finished got (%v, %v), want (true, 1)", finished, exitCode)
+	}
+	if sm.blocked {
+		t.Errorf("proxies are still blocked after the task failed to start")
+	}
+}
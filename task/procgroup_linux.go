@@ -0,0 +1,350 @@
+package task
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/prashantv/autobld/log"
+)
+
+// envGroupID is set for every task, and inherited by all the processes it starts,
+// so they can be found by scanning /proc if cgroups are not available.
+const envGroupID = "AUTOBLD_GROUP_ID"
+
+// scanCacheTime is how long the processes found by scanning /proc are reused for,
+// as reading every process's environment is slow.
+const scanCacheTime = time.Second
+
+var groupSeq int32
+
+// procGroup tracks all the processes started by a task, including any that escape
+// its process group using setsid or by double-forking. If possible, the task is
+// placed in its own cgroup v2. Otherwise, /proc is scanned for processes that inherited
+// envGroupID, and for descendants of the task while it is running.
+type procGroup struct {
+	sync.Mutex
+	id  string
+	pid int
+	// cgroup is the cgroup directory for the task, or empty if cgroups are not used.
+	// If cgroupDir is set, the task is started directly in the cgroup.
+	cgroup    string
+	cgroupDir *os.File
+	// reaped is set once the task has been waited for, after which its pid may be reused.
+	reaped bool
+	// scanned are the processes found by the last scan of /proc, at scannedAt.
+	scanned   []int
+	scannedAt time.Time
+}
+
+// newProcGroup returns a procGroup, and sets envGroupID for cmd. If possible, it creates a
+// cgroup for the task, and sets up cmd to start in it. It must be called before cmd is started.
+func newProcGroup(cmd *exec.Cmd) *procGroup {
+	g := &procGroup{
+		id: fmt.Sprintf("%v-%v", os.Getpid(), atomic.AddInt32(&groupSeq, 1)),
+	}
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, envGroupID+"="+g.id)
+
+	parent, err := ownCgroup()
+	if err != nil {
+		log.VV("Not using cgroups, falling back to scanning /proc: %v", err)
+		return g
+	}
+	dir := filepath.Join(parent, "autobld-"+g.id)
+	if err := os.Mkdir(dir, 0755); err != nil {
+		log.VV("Not using cgroups, falling back to scanning /proc: %v", err)
+		return g
+	}
+	g.cgroup = dir
+
+	if cloneIntoCgroup() {
+		// Starting the task in the cgroup means that nothing it forks can escape it.
+		if f, err := os.Open(dir); err == nil {
+			g.cgroupDir = f
+			cmd.SysProcAttr.UseCgroupFD = true
+			cmd.SysProcAttr.CgroupFD = int(f.Fd())
+		}
+	}
+	return g
+}
+
+// cloneIntoCgroup returns whether the kernel supports starting processes directly in a
+// cgroup using CLONE_INTO_CGROUP, which was added in Linux 5.7.
+func cloneIntoCgroup() bool {
+	var uts syscall.Utsname
+	if err := syscall.Uname(&uts); err != nil {
+		return false
+	}
+	var release []byte
+	for _, c := range uts.Release {
+		if c == 0 {
+			break
+		}
+		release = append(release, byte(c))
+	}
+	var major, minor int
+	fmt.Sscanf(string(release), "%d.%d", &major, &minor)
+	return major > 5 || (major == 5 && minor >= 7)
+}
+
+// start is called once the task has started. If the task could not be started in its cgroup,
+// it is moved into the cgroup as soon as it starts, before it is likely to have started other
+// processes.
+func (g *procGroup) start(pid int) {
+	g.pid = pid
+	if g.cgroupDir != nil {
+		g.cgroupDir.Close()
+		g.cgroupDir = nil
+		log.VV("Started task in cgroup %v", g.cgroup)
+		return
+	}
+	if g.cgroup == "" {
+		return
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(g.cgroup, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0644); err != nil {
+		log.VV("Not using cgroups, falling back to scanning /proc: %v", err)
+		os.Remove(g.cgroup)
+		g.cgroup = ""
+		return
+	}
+	log.VV("Moved task to cgroup %v", g.cgroup)
+}
+
+// failed is called if the task could not be started, and removes its cgroup.
+func (g *procGroup) failed() {
+	if g.cgroupDir != nil {
+		g.cgroupDir.Close()
+	}
+	if g.cgroup != "" {
+		os.Remove(g.cgroup)
+	}
+}
+
+// exited is called once the task has been waited for. Its descendants are no longer
+// walked when scanning /proc, as its pid may be reused by an unrelated process.
+func (g *procGroup) exited() {
+	g.Lock()
+	defer g.Unlock()
+	g.reaped = true
+	g.scanned = nil
+}
+
+// ownCgroup returns the directory for autobld's own cgroup v2.
+func ownCgroup() (string, error) {
+	mount, err := cgroup2Mount()
+	if err != nil {
+		return "", err
+	}
+
+	cgroups, err := ioutil.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(cgroups), "\n") {
+		if strings.HasPrefix(line, "0::") {
+			return filepath.Join(mount, strings.TrimPrefix(line, "0::")), nil
+		}
+	}
+	return "", fmt.Errorf("no cgroup v2 found in /proc/self/cgroup")
+}
+
+// cgroup2Mount returns where the cgroup v2 hierarchy is mounted.
+func cgroup2Mount() (string, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// The filesystem type is the first field after the " - " separator.
+		parts := strings.SplitN(scanner.Text(), " - ", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[1], "cgroup2 ") {
+			continue
+		}
+		if fields := strings.Fields(parts[0]); len(fields) >= 5 {
+			return fields[4], nil
+		}
+	}
+	return "", fmt.Errorf("cgroup2 is not mounted")
+}
+
+// pids returns the processes in the group.
+func (g *procGroup) pids() []int {
+	if g.cgroup != "" {
+		return g.cgroupPids()
+	}
+	return g.scanPids()
+}
+
+func (g *procGroup) cgroupPids() []int {
+	procs, err := ioutil.ReadFile(filepath.Join(g.cgroup, "cgroup.procs"))
+	if err != nil {
+		return nil
+	}
+	var pids []int
+	for _, s := range strings.Fields(string(procs)) {
+		if pid, err := strconv.Atoi(s); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	return pids
+}
+
+// scanPids scans /proc for processes with the task's envGroupID, and descendants of the
+// task while it is running. The result of a scan is reused for scanCacheTime, without
+// any processes that have since exited.
+func (g *procGroup) scanPids() []int {
+	g.Lock()
+	defer g.Unlock()
+
+	if time.Since(g.scannedAt) < scanCacheTime && g.scanned != nil {
+		var alive []int
+		for _, pid := range g.scanned {
+			if state, _ := readStat(pid); state != "" && state != "Z" {
+				alive = append(alive, pid)
+			}
+		}
+		g.scanned = alive
+		return alive
+	}
+
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+
+	marker := []byte(envGroupID + "=" + g.id + "\x00")
+	self := os.Getpid()
+	children := make(map[int][]int)
+	inGroup := make(map[int]bool)
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil || pid == self {
+			continue
+		}
+		if _, ppid := readStat(pid); ppid > 0 {
+			children[ppid] = append(children[ppid], pid)
+		}
+		if environ, err := ioutil.ReadFile(fmt.Sprintf("/proc/%v/environ", pid)); err == nil {
+			if strings.Contains(string(environ), string(marker)) {
+				inGroup[pid] = true
+			}
+		}
+	}
+
+	// Add all descendants of the task, in case they cleared their environment. Once the task
+	// has exited, its orphans are reparented, and its pid may belong to another process.
+	if !g.reaped {
+		for queue := []int{g.pid}; len(queue) > 0; queue = queue[1:] {
+			pid := queue[0]
+			if pid != g.pid {
+				inGroup[pid] = true
+			}
+			queue = append(queue, children[pid]...)
+		}
+	}
+
+	pids := []int{}
+	for pid := range inGroup {
+		pids = append(pids, pid)
+	}
+	g.scanned = pids
+	g.scannedAt = time.Now()
+	return pids
+}
+
+// readStat returns the state (e.g. "Z" for a zombie) and parent process ID from /proc/[pid]/stat.
+func readStat(pid int) (state string, ppid int) {
+	stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%v/stat", pid))
+	if err != nil {
+		return "", 0
+	}
+	// The command name is in parentheses and may contain spaces, so skip past it.
+	s := string(stat)
+	fields := strings.Fields(s[strings.LastIndexByte(s, ')')+1:])
+	if len(fields) < 2 {
+		return "", 0
+	}
+	ppid, _ = strconv.Atoi(fields[1])
+	return fields[0], ppid
+}
+
+// signal sends sig to every process in the group, other than those in the process group
+// pgid which have already been signalled, and returns the number of processes signalled.
+func (g *procGroup) signal(sig syscall.Signal, pgid int) int {
+	if sig == syscall.SIGKILL && g.cgroup != "" {
+		// cgroup.kill kills all processes atomically, including any being forked.
+		if err := ioutil.WriteFile(filepath.Join(g.cgroup, "cgroup.kill"), []byte("1"), 0644); err == nil {
+			return len(g.cgroupPids())
+		}
+	}
+
+	var n int
+	for _, pid := range g.pids() {
+		if p, err := syscall.Getpgid(pid); err == nil && p == pgid {
+			continue
+		}
+		if syscall.Kill(pid, sig) == nil {
+			n++
+		}
+	}
+	return n
+}
+
+// describe returns descriptions of the given processes, e.g. "1234 (server)".
+func describe(pids []int) []string {
+	var desc []string
+	for _, pid := range pids {
+		comm, err := ioutil.ReadFile(fmt.Sprintf("/proc/%v/comm", pid))
+		if err != nil {
+			desc = append(desc, strconv.Itoa(pid))
+			continue
+		}
+		desc = append(desc, fmt.Sprintf("%v (%v)", pid, strings.TrimSpace(string(comm))))
+	}
+	return desc
+}
+
+// survivors returns descriptions of the processes in the group, once the task has exited.
+func (g *procGroup) survivors() []string {
+	return describe(g.pids())
+}
+
+// killSurvivors kills all processes in the group once the task has exited,
+// and returns descriptions of the processes that were killed.
+func (g *procGroup) killSurvivors() []string {
+	desc := g.survivors()
+	if len(desc) == 0 {
+		return nil
+	}
+
+	g.signal(syscall.SIGKILL, 0)
+	// Wait for the killed processes to be removed from the cgroup, so it can be removed.
+	for i := 0; i < 50 && len(g.pids()) > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return desc
+}
+
+// close removes the task's cgroup if it is empty. The cgroup is still used to find
+// processes after it is removed, as it is known to be empty.
+func (g *procGroup) close() {
+	if g.cgroup != "" && len(g.cgroupPids()) == 0 {
+		os.Remove(g.cgroup)
+	}
+}
@@ -0,0 +1,25 @@
+//go:build !linux
+// +build !linux
+
+package task
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// procGroup is only supported on Linux. On other platforms, the task's
+// process group is used to stop the task.
+type procGroup struct{}
+
+func newProcGroup(cmd *exec.Cmd) *procGroup {
+	return &procGroup{}
+}
+
+func (g *procGroup) start(pid int)                           {}
+func (g *procGroup) failed()                                 {}
+func (g *procGroup) exited()                                 {}
+func (g *procGroup) signal(sig syscall.Signal, pgid int) int { return 0 }
+func (g *procGroup) survivors() []string                     { return nil }
+func (g *procGroup) killSurvivors() []string                 { return nil }
+func (g *procGroup) close()                                  {}
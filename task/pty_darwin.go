@@ -0,0 +1,28 @@
+package task
+
+import (
+	"bytes"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// unlockPTY grants access to and unlocks the pseudo-terminal master, and returns the
+// path of its slave.
+func unlockPTY(master *os.File) (string, error) {
+	if err := ioctl(master, syscall.TIOCPTYGRANT, nil); err != nil {
+		return "", err
+	}
+	if err := ioctl(master, syscall.TIOCPTYUNLK, nil); err != nil {
+		return "", err
+	}
+	// TIOCPTYGNAME writes the NUL-terminated path of the slave, which is at most 128 bytes.
+	var name [128]byte
+	if err := ioctl(master, syscall.TIOCPTYGNAME, unsafe.Pointer(&name[0])); err != nil {
+		return "", err
+	}
+	if i := bytes.IndexByte(name[:], 0); i >= 0 {
+		return string(name[:i]), nil
+	}
+	return string(name[:]), nil
+}
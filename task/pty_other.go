@@ -0,0 +1,20 @@
+// +build !linux,!darwin
+
+package task
+
+import (
+	"errors"
+	"os"
+)
+
+func openPTY() (master, slave *os.File, err error) {
+	return nil, nil, errors.New("tty is not supported on this platform")
+}
+
+func forwardResize(master *os.File, done <-chan struct{}) {}
+
+// SetRawTerminal is not supported on this platform, as tasks cannot run under a
+// pseudo-terminal.
+func SetRawTerminal(signals bool) func() {
+	return func() {}
+}
@@ -0,0 +1,94 @@
+// +build linux darwin
+
+package task
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"unsafe"
+
+	"github.com/prashantv/autobld/log"
+)
+
+// winsize is the struct used by the TIOCGWINSZ and TIOCSWINSZ ioctls.
+type winsize struct {
+	rows, cols, x, y uint16
+}
+
+// openPTY opens a new pseudo-terminal, and returns the master and slave. Input is
+// echoed by the pseudo-terminal, as autobld's own terminal is put in raw mode, and
+// newlines are not translated so output files do not contain carriage returns.
+func openPTY() (master, slave *os.File, err error) {
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	name, err := unlockPTY(master)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	slave, err = os.OpenFile(name, os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+
+	var termios syscall.Termios
+	if err := ioctl(slave, tcgets, unsafe.Pointer(&termios)); err == nil {
+		termios.Oflag &^= syscall.ONLCR
+		ioctl(slave, tcsets, unsafe.Pointer(&termios))
+	}
+	resizePTY(master)
+	return master, slave, nil
+}
+
+// resizePTY sets the size of the pseudo-terminal to the size of autobld's terminal.
+func resizePTY(master *os.File) {
+	var ws winsize
+	if err := ioctl(os.Stdout, syscall.TIOCGWINSZ, unsafe.Pointer(&ws)); err != nil {
+		// autobld is not running in a terminal.
+		return
+	}
+	if err := ioctl(master, syscall.TIOCSWINSZ, unsafe.Pointer(&ws)); err != nil {
+		log.VV("Failed to resize pty: %v", err)
+	}
+}
+
+// forwardResize resizes the pseudo-terminal whenever autobld's terminal is resized,
+// until done is closed. The kernel sends SIGWINCH to the task on every resize.
+func forwardResize(master *os.File, done <-chan struct{}) {
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	defer signal.Stop(winch)
+	for {
+		select {
+		case <-winch:
+			resizePTY(master)
+		case <-done:
+			return
+		}
+	}
+}
+
+// SetRawTerminal puts autobld's terminal in raw mode for tasks that run under a
+// pseudo-terminal, so every key is sent to the task as soon as it is typed, and the
+// pseudo-terminal echoes it. If signals is false, keys such as Ctrl-C are also sent to
+// the task rather than signalling autobld. It returns a function that restores the terminal.
+func SetRawTerminal(signals bool) func() {
+	restore, err := setTermios(os.Stdin, func(termios *syscall.Termios) {
+		termios.Lflag &^= syscall.ICANON | syscall.ECHO | syscall.IEXTEN
+		if !signals {
+			termios.Lflag &^= syscall.ISIG
+		}
+		termios.Iflag &^= syscall.ICRNL | syscall.IXON
+		termios.Cc[syscall.VMIN] = 1
+		termios.Cc[syscall.VTIME] = 0
+	})
+	if err != nil {
+		log.V("Failed to put the terminal in raw mode: %v", err)
+	}
+	return restore
+}
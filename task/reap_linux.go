@@ -0,0 +1,61 @@
+package task
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"github.com/prashantv/autobld/log"
+)
+
+// prSetChildSubreaper is the prctl option to become a child subreaper.
+const prSetChildSubreaper = 36
+
+// StartReaper reaps zombie processes that are reparented to autobld, such as orphaned
+// processes started by tasks when autobld is the init process of a container. If autobld
+// is not PID 1, it becomes a child subreaper, so orphaned descendants are reparented to it.
+func StartReaper() error {
+	if os.Getpid() != 1 {
+		if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetChildSubreaper, 1, 0); errno != 0 {
+			return fmt.Errorf("failed to become a child subreaper: %v", errno)
+		}
+	}
+
+	sigC := make(chan os.Signal, 1)
+	signal.Notify(sigC, syscall.SIGCHLD)
+	go func() {
+		for range sigC {
+			reapZombies()
+		}
+	}()
+	return nil
+}
+
+// reapZombies waits for any exited child processes that were not started by New,
+// as those are waited for by their Task.
+func reapZombies() {
+	startMu.Lock()
+	defer startMu.Unlock()
+
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return
+	}
+	self := os.Getpid()
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil || started[pid] {
+			continue
+		}
+		if state, ppid := readStat(pid); state != "Z" || ppid != self {
+			continue
+		}
+		var ws syscall.WaitStatus
+		if wpid, err := syscall.Wait4(pid, &ws, syscall.WNOHANG, nil); err == nil && wpid == pid {
+			log.VV("Reaped orphaned process %v", pid)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+// +build !linux
+
+package task
+
+import "errors"
+
+// StartReaper is only supported on Linux.
+func StartReaper() error {
+	return errors.New("reaping zombie processes is only supported on Linux")
+}
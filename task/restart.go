@@ -0,0 +1,89 @@
+package task
+
+import (
+	"strings"
+	"time"
+
+	"github.com/prashantv/autobld/config"
+	"github.com/prashantv/autobld/log"
+)
+
+// handleExit is called when the server exits without being stopped by a change.
+// It logs how the task exited, and schedules a restart based on the restart policy.
+// For one-shot tasks, it reports whether the run passed instead.
+func (t *SM) handleExit() {
+	t.exitHandled = true
+	if t.oneshot() {
+		t.reportRun()
+		if t.Task.Success() {
+			t.setReady()
+		}
+		return
+	}
+
+	r := t.c.Restart
+	log.L(t.prefix+"Task exited (%v)", t.Task.State())
+	if survivors := t.Task.Survivors(); len(survivors) > 0 {
+		log.L(t.prefix+"Processes started by the task are still running: %v", strings.Join(survivors, ", "))
+	}
+	t.reportFailure(t.Task.State())
+	t.startHook(hookOnCrash, t.c.Hooks.OnCrash, t.changes, t.Task)
+
+	switch {
+	case r.Policy == config.RestartNever:
+		return
+	case r.Policy == config.RestartOnFailure && t.Task.Success():
+		return
+	}
+
+	now := time.Now()
+	if t.crashLoop(now) {
+		log.L(t.prefix+"!!! Task is crash looping: it exited %v times within %v. It will not be restarted till the next change !!!",
+			len(t.exits), r.CrashLoopWindow)
+		return
+	}
+	if r.MaxAttempts > 0 && t.attempts >= r.MaxAttempts {
+		log.L(t.prefix+"Task has been restarted %v times, it will not be restarted till the next change", t.attempts)
+		return
+	}
+
+	delay := t.backoff()
+	t.attempts++
+	log.L(t.prefix+"Restarting task in %v (attempt %v)", delay, t.attempts)
+	t.restartAt = now.Add(delay)
+	go t.reprocessAfter(delay)
+}
+
+// crashLoop records an exit at now, and returns whether there have been
+// too many exits within the crash loop window.
+func (t *SM) crashLoop(now time.Time) bool {
+	r := t.c.Restart
+	var recent []time.Time
+	for _, e := range t.exits {
+		if now.Sub(e) < r.CrashLoopWindow {
+			recent = append(recent, e)
+		}
+	}
+	t.exits = append(recent, now)
+	return len(t.exits) >= r.CrashLoopCount
+}
+
+// backoff returns the delay before the next restart attempt.
+func (t *SM) backoff() time.Duration {
+	r := t.c.Restart
+	delay := r.Backoff
+	for i := 0; i < t.attempts && delay < r.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > r.MaxBackoff {
+		delay = r.MaxBackoff
+	}
+	return delay
+}
+
+// resetRestarts resets the restart attempts and crash loop detection after a change.
+func (t *SM) resetRestarts() {
+	t.restartAt = time.Time{}
+	t.attempts = 0
+	t.exits = nil
+}
@@ -0,0 +1,93 @@
+// +build !windows
+
+package task
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prashantv/autobld/config"
+)
+
+func TestBackoff(t *testing.T) {
+	r := config.Restart{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	want := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	sm := &SM{c: &config.Task{Restart: r}}
+	for attempts, w := range want {
+		sm.attempts = attempts
+		if got := sm.backoff(); got != w*time.Millisecond {
+			t.Errorf("%v attempts: backoff got %v, want %v", attempts, got, w*time.Millisecond)
+		}
+	}
+}
+
+func TestRestart(t *testing.T) {
+	tests := []struct {
+		msg      string
+		exitCode int
+		restart  config.Restart
+		wantRuns int
+	}{
+		{
+			msg:      "never restarts",
+			exitCode: 1,
+			restart:  config.Restart{Policy: config.RestartNever},
+			wantRuns: 1,
+		},
+		{
+			msg:      "on-failure does not restart after success",
+			exitCode: 0,
+			restart:  config.Restart{Policy: config.RestartOnFailure},
+			wantRuns: 1,
+		},
+		{
+			msg:      "gives up after max attempts",
+			exitCode: 1,
+			restart:  config.Restart{Policy: config.RestartOnFailure, MaxAttempts: 2, CrashLoopCount: 10},
+			wantRuns: 3,
+		},
+		{
+			msg:      "gives up on a crash loop",
+			exitCode: 0,
+			restart:  config.Restart{Policy: config.RestartAlways, CrashLoopCount: 4},
+			wantRuns: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		dir := tempDir(t)
+		defer os.RemoveAll(dir)
+		runs := filepath.Join(dir, "runs")
+
+		c := shellTask(fmt.Sprintf("echo run >> %v; exit %v", runs, tt.exitCode))
+		c.Restart = tt.restart
+		c.Restart.Backoff = 10 * time.Millisecond
+		c.Restart.MaxBackoff = 20 * time.Millisecond
+		c.Restart.CrashLoopWindow = time.Minute
+		sm := newTestSM(c)
+
+		// The task has given up once its last exit has been handled without a restart.
+		finished := func() bool {
+			return sm.Task != nil && sm.Task.Exited() && sm.exitHandled && sm.restartAt.IsZero()
+		}
+		if !runSM(t, sm, finished) {
+			t.Errorf("%v: task did not give up: %v", tt.msg, sm.Status())
+		}
+		if got := len(readLines(runs)); got != tt.wantRuns {
+			t.Errorf("%v: runs got %v, want %v", tt.msg, got, tt.wantRuns)
+		}
+
+		// A change resets the restart attempts and crash loop detection.
+		sm.Reload("")
+		if !runSM(t, sm, func() bool { return !sm.PendingClose() && finished() }) {
+			t.Errorf("%v: task did not give up after a change: %v", tt.msg, sm.Status())
+		}
+		if got := len(readLines(runs)); got != 2*tt.wantRuns {
+			t.Errorf("%v: runs after a change got %v, want %v", tt.msg, got, 2*tt.wantRuns)
+		}
+		closeTestSM(sm)
+	}
+}
@@ -1,45 +1,262 @@
 package task
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/prashantv/autobld/config"
 	"github.com/prashantv/autobld/log"
-	"github.com/prashantv/autobld/syncv"
+	"github.com/prashantv/autobld/proxy"
 )
 
 // SM is used to store state about the currently running task.
 type SM struct {
+	// Task is the process for the step that is currently running.
 	Task *Task
-	c    *config.Config
+	c    *config.Task
+	// prefix is prepended to all logs, and contains the task name if there is one.
+	prefix string
+
+	// steps are the steps for the current run, which are any pending generators followed by c.Steps.
+	steps []config.Step
+	// step is the index of the step in steps that Task is running.
+	step int
+	// failed is set when a build step fails, and is cleared on the next Reload.
+	failed bool
+
+	// generators are the matchers with a Run command that need to run before the next restart.
+	generators []*config.Matcher
+	// stepGenerators are the generators for the first steps of the current run.
+	stepGenerators []*config.Matcher
+	// generatedAt is the time at which the last generator exited. Changes are deferred till
+	// the change timeout after it, and deferred are the changes detected in that time.
+	generatedAt time.Time
+	deferred    []deferredChange
+
+	// pendingChanges are the files that have changed since the last restart.
+	pendingChanges []string
+	// changes are the files that changed before the current run, and reloadSeq
+	// is the number of times the task has been reloaded.
+	changes   []string
+	reloadSeq int
+	// env is the last successfully loaded environment for the task.
+	env []string
+	// runStart is the time at which the first step of the current run was started.
+	runStart time.Time
+
+	// tail keeps the end of Task's STDERR, if the task has an HTTP proxy.
+	tail *tailWriter
+	// backend is shared with the task's proxies, and used to report failures.
+	backend *proxy.Backend
+
+	// diag parses diagnostics from the output of Task, till they are reported once it exits.
+	diag *diagWriter
+	// stepDiagnostics are the diagnostics from each step of the current run.
+	stepDiagnostics [][]diagnostic
+
+	// server is the previous server, which is kept running while the build steps
+	// run when BuildBeforeSwap is set.
+	server *Task
+	// stopRequest is the time at which server was requested to stop.
+	stopRequest time.Time
+
+	// deps are the state machines for tasks that must be ready before this task starts.
+	deps []*SM
+	// dependents are the state machines for tasks that depend on this task.
+	dependents []*SM
+	// started is set once the server has been started for the first time.
+	started bool
+	// waiting is set while the task is waiting for its dependencies to be ready.
+	waiting bool
+
+	// probe is the readiness probe for the server, which is set till the probe completes.
+	probe *probe
+	// ready is set once the server has passed its readiness probe.
+	ready bool
+	// startFailed is set if the server failed its readiness probe.
+	startFailed bool
+	// serverStart is the time at which the server was last started.
+	serverStart time.Time
+
+	// portWait is the time at which the server started waiting for the proxies'
+	// forwardTo ports to be released.
+	portWait time.Time
+	// startErr is set if the server cannot be started, e.g. as the ports were not
+	// released within the port timeout. It is cleared on the next Reload.
+	startErr error
+
+	// beforeStart and changeHook are the beforeStart and onChangeDetected hooks that
+	// are running in the background, which the server start and the restart wait for.
+	beforeStart *hookRun
+	changeHook  *hookRun
+	// hooks are the hooks that have been started, which are killed when autobld exits.
+	hooks []*hookRun
+
+	// exitHandled is set once the server exiting on its own has been handled.
+	exitHandled bool
+	// restartAt is the time at which the server will be restarted after it exited.
+	restartAt time.Time
+	// attempts is the number of restarts since the last change.
+	attempts int
+	// exits are the recent times at which the server exited, used to detect crash loops.
+	exits []time.Time
+
+	// signalAt is the time at which changeSignal will be sent to the server
+	// after a change that does not need a restart.
+	signalAt     time.Time
+	changeSignal config.Signal
 
 	// reloadRequest is the time at which a Reload was requested.
 	reloadRequest time.Time
-	// done is set to True once a task ends.
-	done syncv.Bool
 	// blockRequests is used to block all proxy port requests after a Reload is requested.
 	blockRequests *sync.WaitGroup
+	// blocked is whether blockRequests is currently blocking requests.
+	blocked bool
 
 	// Reprocess is the channel the caller waits on to reprocess the state machine.
 	Reprocess chan struct{}
-	// reloadEnded is written to when a Reload is complete (eg the task has ended).
-	reloadEnded chan struct{}
 }
 
 // NewSM returns the state maachine used to run tasks.
-func NewSM(c *config.Config, blockRequests *sync.WaitGroup) *SM {
-	return &SM{
+// The caller should block requests using blockRequests till the first task starts.
+// backend is shared with the task's proxies. Multiple state machines may share the
+// same reprocess channel.
+func NewSM(c *config.Task, blockRequests *sync.WaitGroup, backend *proxy.Backend, reprocess chan struct{}) *SM {
+	t := &SM{
 		c:             c,
 		blockRequests: blockRequests,
-		Reprocess:     make(chan struct{}),
-		reloadEnded:   make(chan struct{}),
+		backend:       backend,
+		blocked:       true,
+		Reprocess:     reprocess,
+		steps:         c.Steps,
+	}
+	if c.Name != "" {
+		t.prefix = "[" + c.Name + "] "
+	}
+	if t.oneshot() {
+		// Proxies are never blocked for one-shot tasks.
+		t.unblock()
 	}
+	return t
+}
+
+// Config returns the configuration for the task.
+func (t *SM) Config() *config.Task {
+	return t.c
+}
+
+// DependsOn adds dep as a dependency of this task.
+// The task will only start once dep is ready, and will be restarted when dep restarts.
+func (t *SM) DependsOn(dep *SM) {
+	t.deps = append(t.deps, dep)
+	dep.dependents = append(dep.dependents, t)
+}
+
+// Ready returns whether the task's server is running and has passed its readiness probe.
+// A one-shot task is ready once its last run has passed.
+func (t *SM) Ready() bool {
+	if t.oneshot() {
+		return t.ready && !t.PendingClose()
+	}
+	return t.Running() && t.isLastStep() && !t.PendingClose() && t.ready
+}
+
+// Finished returns whether the task is ready, or has failed and will not be restarted
+// till the next change. exitCode is 0 if the task is ready, and non-zero otherwise.
+// A server that exits before it is ready has failed, even if it exited successfully.
+// A server without a readiness probe is only ready once it has been running for grace.
+func (t *SM) Finished(grace time.Duration) (finished bool, exitCode int) {
+	switch {
+	case t.Ready() && !t.oneshot() && t.c.Ready == nil && time.Since(t.serverStart) < grace:
+		return false, 0
+	case t.Ready():
+		return true, 0
+	case t.startErr != nil:
+		return true, 1
+	case t.Task == nil || t.PendingClose():
+		return false, 0
+	case t.startFailed:
+		return true, 1
+	case t.failed, t.isLastStep() && t.exitHandled && t.restartAt.IsZero():
+		if code := t.Task.ExitCode(); code > 0 {
+			return true, code
+		}
+		return true, 1
+	}
+	return false, 0
+}
+
+// Crashed returns whether the server has exited without being stopped, and its exit code.
+// One-shot tasks never crash, as they are expected to exit.
+func (t *SM) Crashed() (crashed bool, exitCode int) {
+	if t.oneshot() || t.Task == nil || !t.isLastStep() || !t.Task.Exited() || t.PendingClose() {
+		return false, 0
+	}
+	return true, t.Task.ExitCode()
+}
+
+// Status returns a short description of the task's current state.
+func (t *SM) Status() string {
+	var status string
+	switch {
+	case t.PendingClose():
+		status = "restarting"
+	case t.waiting:
+		status = "waiting for dependencies"
+	case !t.restartAt.IsZero():
+		status = fmt.Sprintf("exited (%v), restarting in %v", t.Task.State(), time.Until(t.restartAt).Round(time.Millisecond))
+	case t.startErr != nil:
+		status = "not started, " + t.startErr.Error()
+	case !t.portWait.IsZero():
+		status = "waiting for the port to be released"
+	case t.beforeStart != nil:
+		status = "running beforeStart hook"
+	case t.Task == nil:
+		status = "not started"
+	case t.failed:
+		status = fmt.Sprintf("step %v failed (%v)", t.steps[t.step].Name, t.Task.State())
+	case t.Task.Exited():
+		status = fmt.Sprintf("exited (%v)", t.Task.State())
+	case !t.isLastStep():
+		status = fmt.Sprintf("running step %v", t.steps[t.step].Name)
+	case t.oneshot():
+		status = "running"
+	case t.startFailed:
+		status = "running, failed readiness probe"
+	case t.ready:
+		status = "ready"
+	default:
+		status = "starting"
+	}
+	if t.Running() {
+		status += fmt.Sprintf(", pid %v", t.Task.process.Pid)
+	}
+	return fmt.Sprintf("%v, run %v", status, t.reloadSeq+1)
+}
+
+// depsReady returns whether all dependencies are ready, and logs the first one that isn't.
+func (t *SM) depsReady() bool {
+	for _, dep := range t.deps {
+		if !dep.Ready() {
+			if !t.waiting {
+				log.L(t.prefix+"Waiting for dependency %v to be ready", dep.c.Name)
+				t.waiting = true
+			}
+			return false
+		}
+	}
+	t.waiting = false
+	return true
 }
 
 // Running returns whether the task is currently running.
 func (t *SM) Running() bool {
-	return t.Task != nil && !t.done.Read()
+	return t.Task != nil && !t.Task.Exited()
 }
 
 // PendingClose returns whether there is a close request which hasn't yet been completed.
@@ -53,25 +270,121 @@ func (t *SM) PastChangeTime() bool {
 	return t.reloadRequest.Add(t.c.ChangeTimeout).Before(time.Now())
 }
 
-// PastKillTime returns whether we are past the kill buffer timeout.
-func (t *SM) PastKillTime() bool {
-	return t.reloadRequest.Add(t.c.ChangeTimeout + t.c.KillTimeout).Before(time.Now())
+// isLastStep returns whether the current step is the long-running server.
+func (t *SM) isLastStep() bool {
+	return t.step == len(t.steps)-1
+}
+
+// swap returns whether the server should be kept running till the build steps succeed.
+func (t *SM) swap() bool {
+	return t.c.BuildBeforeSwap && len(t.c.Steps) > 1
+}
+
+// serving returns whether the previous server is still running during a build.
+func (t *SM) serving() bool {
+	return t.server != nil && !t.server.Exited()
 }
 
 // Execute runs the state machine, and returns whether it needs to be rerun
 func (t *SM) Execute() (bool, error) {
+	if len(t.deferred) > 0 && !t.generating() {
+		t.reloadDeferred()
+	}
+	if t.changeHook != nil {
+		t.changeDetected()
+	}
+	if t.diag != nil && t.Task != nil && t.Task.Exited() {
+		t.reportDiagnostics()
+	}
+
 	switch {
+	case !t.signalAt.IsZero() && !time.Now().Before(t.signalAt):
+		t.signalAt = time.Time{}
+		if t.Running() && t.isLastStep() && !t.PendingClose() {
+			log.L(t.prefix+"Sending %v to task", t.changeSignal)
+			t.signal(t.Task, t.changeSignal)
+		}
+		return true, nil
+	case t.Task == nil && t.isLastStep() && t.server != nil:
+		return t.stopServer(), nil
+	case t.PendingClose():
+		if !t.PastChangeTime() {
+			return false, nil
+		}
+		if t.Running() && t.swap() && t.isLastStep() {
+			// Keep the server running while the new build runs.
+			t.server = t.Task
+			t.clear()
+			return true, nil
+		}
+		if t.Running() {
+			t.closeTask(t.Task)
+			return false, nil
+		}
+
+		if t.oneshot() {
+			t.finishRun()
+		}
+		if t.Task != nil {
+			t.stopped(t.Task)
+		}
+		t.clear()
+		return true, nil
+	case t.probe != nil && t.probe.finished():
+		p := t.probe
+		t.probe = nil
+		if p.err != nil {
+			log.L(t.prefix+"Task failed to start: %v", p.err)
+			t.reportFailure("failed readiness probe: " + p.err.Error())
+			t.startFailed = true
+			t.unblock()
+			return true, nil
+		}
+		log.L(t.prefix + "Task is ready")
+		t.setReady()
+		return true, nil
+	case t.Task != nil && t.isLastStep() && t.Task.Exited() && !t.exitHandled:
+		t.handleExit()
+		return false, nil
+	case !t.restartAt.IsZero():
+		if time.Now().Before(t.restartAt) {
+			return false, nil
+		}
+		t.restartAt = time.Time{}
+		t.killSurvivors(t.Task)
+		t.Task = nil
+		return true, nil
+	case t.Task == nil && t.step == 0 && !t.depsReady():
+		return false, nil
+	case t.Task == nil && t.startErr != nil:
+		return false, nil
+	case t.Task == nil && t.isLastStep() && !t.portsFree():
+		return false, nil
 	case t.Task == nil:
 		if err := t.startTask(); err != nil {
 			return false, err
 		}
-	case t.PendingClose() && t.PastChangeTime():
-		if !t.done.Read() {
-			t.closeTask()
+	case t.Task.Exited() && !t.isLastStep() && !t.failed:
+		step := t.steps[t.step]
+		if !t.Task.Success() {
+			log.L(t.prefix+"Step %v failed (%v), waiting for changes", step.Name, t.Task.State())
+			if t.serving() {
+				log.L(t.prefix + "Keeping the previous task running")
+			}
+			if t.oneshot() {
+				t.reportRun()
+			}
+			t.reportFailure(t.Task.State())
+			t.generatorExited(false)
+			t.failed = true
+			t.unblock()
 			return false, nil
 		}
 
-		t.clear()
+		log.V(t.prefix+"Step %v completed", step.Name)
+		t.generatorExited(true)
+		t.step++
+		t.Task = nil
 		return true, nil
 	}
 
@@ -79,91 +392,380 @@ func (t *SM) Execute() (bool, error) {
 }
 
 func (t *SM) startTask() error {
-	var err error
-	t.Task, err = New(t.c.BaseDir, t.c.StdOut, t.c.StdErr, t.c.Action)
+	if t.isLastStep() {
+		done, abort := t.awaitHook(&t.beforeStart, hookBeforeStart, t.c.Hooks.BeforeStart, t.changes)
+		if !done {
+			return nil
+		}
+		if abort {
+			t.cannotStart(errors.New("the beforeStart hook failed"))
+			return nil
+		}
+	}
+
+	step := t.steps[t.step]
+	if !log.V(t.prefix+"Starting %v: %v", step.Name, step.Action) {
+		log.L(t.prefix+"Starting %v", step.Name)
+	}
+
+	if t.step == 0 {
+		t.runStart = time.Now()
+	}
+	out, err := newOutput(t.c, t.run(step))
 	if err != nil {
 		return err
 	}
+	var diag *diagWriter
+	if t.c.Diagnostics != nil {
+		if t.step == 0 {
+			t.stepDiagnostics = make([][]diagnostic, len(t.steps))
+		}
+		// Diagnostics are written to STDERR, which is combined with STDOUT for a TTY.
+		diag = newDiagWriter(t.c.Diagnostics)
+		if t.c.TTY {
+			out.stdout = io.MultiWriter(out.stdout, diag)
+		} else {
+			out.stderr = io.MultiWriter(out.stderr, diag)
+		}
+	}
+	var tail *tailWriter
+	if t.hasHTTPProxy() {
+		tail = &tailWriter{}
+		if t.c.TTY {
+			out.stdout = io.MultiWriter(out.stdout, tail)
+		} else {
+			out.stderr = io.MultiWriter(out.stderr, tail)
+		}
+	}
+	var p *probe
+	if t.isLastStep() && t.c.Ready != nil {
+		p = newProbe(t.c.Ready)
+		if re := t.c.Ready.StdoutRegexp; re != nil {
+			out.stdout = io.MultiWriter(out.stdout, &regexpWriter{re: re, matched: p.matched})
+		}
+	}
 
-	t.blockRequests.Done()
+	task, err := New(Options{
+		Dir:     t.c.BaseDir,
+		Args:    t.expandArgs(step),
+		Env:     append(t.loadEnv(), t.runEnv()...),
+		Stdout:  out.stdout,
+		Stderr:  out.stderr,
+		Closers: out.closers,
+		TTY:     t.c.TTY,
+	})
+	if err != nil {
+		return err
+	}
+	t.Task = task
+	if t.isLastStep() {
+		t.serverStart = time.Now()
+	}
+	t.diag = diag
+	t.tail = tail
+	t.exitHandled = false
+	t.ready = false
+	t.startFailed = false
 
-	stdinCloser := make(chan struct{})
-	go copyStdin(t.Task.stdinPipe, stdinCloser)
+	if p != nil {
+		log.V(t.prefix + "Waiting for task to be ready")
+		t.probe = p
+		go func() {
+			p.run(task.exited)
+			t.Reprocess <- struct{}{}
+		}()
+	} else if t.isLastStep() && !t.oneshot() {
+		t.setReady()
+	}
+
+	go copyStdin(task.stdinPipe, task.exited)
 	go func() {
-		t.Task.process.Wait()
-		log.V("Task is no longer running")
-		t.done.Write(true)
+		<-task.exited
+		log.V(t.prefix+"Task is no longer running (%v)", task.State())
 		t.Reprocess <- struct{}{}
-		t.reloadEnded <- struct{}{}
-		stdinCloser <- struct{}{}
 	}()
 
 	return nil
 }
 
-func (t *SM) closeTask() {
-	var err error
-	if !t.PastKillTime() {
-		err = t.Task.Interrupt()
-	} else {
-		err = t.Task.Kill()
+// setReady unblocks proxy requests once the server is ready, and restarts
+// any dependent tasks if the server was restarted.
+func (t *SM) setReady() {
+	t.backend.ClearFailure()
+	t.ready = true
+	t.unblock()
+	if t.started {
+		t.reloadDependents()
 	}
-	if err != nil {
-		log.L("Failed to stop task: %v", err)
+	t.started = true
+	if !t.oneshot() {
+		t.startHook(hookAfterStart, t.c.Hooks.AfterStart, t.changes, nil)
+	}
+}
+
+// stopServer stops the previous server once the build steps have succeeded,
+// and returns whether the state machine needs to be rerun.
+func (t *SM) stopServer() bool {
+	if t.server.Exited() {
+		t.stopped(t.server)
+		t.server = nil
+		t.stopRequest = time.Time{}
+		return true
+	}
+
+	if t.stopRequest.IsZero() {
+		log.L(t.prefix + "Build succeeded, restarting task")
+		t.block()
+		t.stopRequest = time.Now()
+		go t.reloadCheck(t.server)
+	}
+	t.closeTask(t.server)
+	return false
+}
+
+// closeTask sends the first stop signal to the given task once the requests being
+// proxied to it and the beforeStop hook have finished, and each subsequent stop signal
+// once the timeout for the previous signal has passed.
+func (t *SM) closeTask(task *Task) {
+	if task.stopSent.IsZero() {
+		if !t.drained(task) {
+			return
+		}
+		if t.isServer(task) {
+			if done, _ := t.awaitHook(&task.beforeStop, hookBeforeStop, t.c.Hooks.BeforeStop, t.changes); !done {
+				return
+			}
+		}
+	}
+
+	stopSignals := t.c.StopSignals
+	if !task.stopSent.IsZero() {
+		if task.stopStep == len(stopSignals)-1 || time.Since(task.stopSent) < stopSignals[task.stopStep].Timeout {
+			return
+		}
+		task.stopStep++
+	}
+
+	task.stopSent = time.Now()
+	t.signal(task, stopSignals[task.stopStep].Signal)
+}
+
+// drained returns whether there are no HTTP requests being proxied to the task, or
+// the drain timeout has passed. New requests are blocked while the task is stopped, so
+// only requests that started before the change need to finish. TCP connections are not
+// waited for, as they may be idle. Tasks are not drained unless a drain timeout is set.
+func (t *SM) drained(task *Task) bool {
+	if t.c.DrainTimeout == 0 {
+		return true
+	}
+	active := t.backend.Active()
+	if active == 0 {
+		return true
+	}
+	if task.drainStart.IsZero() {
+		log.V(t.prefix+"Waiting for %v active requests to finish before stopping task", active)
+		task.drainStart = time.Now()
+	}
+	if time.Since(task.drainStart) < t.c.DrainTimeout {
+		return false
+	}
+	log.L(t.prefix+"Stopping task with %v active requests after the drain timeout of %v", active, t.c.DrainTimeout)
+	return true
+}
+
+// signal sends sig to the given task, and logs any errors.
+func (t *SM) signal(task *Task, sig config.Signal) {
+	log.V(t.prefix+"Sending %v to task", sig)
+	if err := task.Signal(syscall.Signal(sig)); err != nil {
+		log.L(t.prefix+"Failed to send %v to task: %v", sig, err)
+	}
+}
+
+// stopTask sends the stop signals to the given task, and blocks till it exits,
+// or the timeout for the last signal has passed.
+func (t *SM) stopTask(task *Task) {
+	if t.isServer(task) && task.stopSent.IsZero() {
+		t.startHook(hookBeforeStop, t.c.Hooks.BeforeStop, t.changes, nil)
+		t.waitHooks()
+	}
+	log.V(t.prefix + "Stopping task")
+	task.Stop(t.c.StopSignals)
+}
+
+// killSurvivors kills any processes started by task that are still running after it
+// exited, such as daemons that escaped its process group, before it is restarted.
+func (t *SM) killSurvivors(task *Task) {
+	if killed := task.KillSurvivors(); len(killed) > 0 {
+		log.L(t.prefix+"Killed processes that were still running after the task exited: %v", strings.Join(killed, ", "))
+	}
+}
+
+// block blocks proxy requests till unblock is called.
+func (t *SM) block() {
+	if !t.blocked && !t.oneshot() {
+		t.blocked = true
+		t.blockRequests.Add(1)
+	}
+}
+
+// unblock allows proxy requests to continue.
+func (t *SM) unblock() {
+	if t.blocked {
+		t.blocked = false
+		t.blockRequests.Done()
 	}
 }
 
 // clear resets the SM once a task has completed running.
 func (t *SM) clear() {
 	t.Task = nil
-	t.done.Write(false)
+	t.probe = nil
+	t.ready = false
+	t.step = 0
+	t.failed = false
+	t.portWait = time.Time{}
+	t.startErr = nil
+	t.beforeStart = nil
+	t.steps = t.generatorSteps()
+	t.nextRun()
 	t.reloadRequest = time.Time{}
 }
 
-// Reload will stop the task if it's running.
+// Reload will stop the task if it's running, after running the Run command for
+// each of the matchers ms, if any. The changed path is passed to the task when it
+// restarts. path and ms may be empty if the reload was not caused by a file change.
+// For file changes, the task is only stopped once the onChangeDetected hook has exited.
 // To make sure the task is closed, a goroutine is set up to reprocess every second.
-func (t *SM) Reload() {
+func (t *SM) Reload(path string, ms ...*config.Matcher) {
+	if t.generating() {
+		t.deferChange(path, ms)
+		return
+	}
+	if path != "" {
+		t.addChange(path)
+	}
+	for _, m := range ms {
+		if len(m.Run) > 0 {
+			t.addGenerator(m)
+		}
+	}
 	if t.PendingClose() {
-		log.Fatalf("Reload called while already waiting for a close")
+		return
 	}
+	if path != "" {
+		t.changeDetected()
+		return
+	}
+	t.changeHook = nil
+	t.reload()
+}
 
-	t.blockRequests.Add(1)
+// changeDetected restarts the task once the onChangeDetected hook has exited, unless
+// it failed with AbortOnFailure set. Changes detected while the hook is running are
+// passed to the task when it restarts.
+func (t *SM) changeDetected() {
+	done, abort := t.awaitHook(&t.changeHook, hookOnChangeDetected, t.c.Hooks.OnChangeDetected, t.pendingChanges)
+	switch {
+	case !done:
+	case abort:
+		log.L(t.prefix + "Not restarting the task as the onChangeDetected hook failed")
+	default:
+		t.reload()
+	}
+}
+
+// reload stops the task if it's running, so that it restarts after the change timeout.
+func (t *SM) reload() {
 	t.reloadRequest = time.Now()
+	t.resetRestarts()
+	t.backend.ClearFailure()
+	if (t.swap() && t.isLastStep() && t.Running()) || (t.serving() && !t.Running()) {
+		log.L(t.prefix+"Change detected, will rebuild in %v while the task keeps running", t.c.ChangeTimeout)
+		go t.reprocessAfter(t.c.ChangeTimeout)
+		return
+	}
+
+	if !t.serving() {
+		t.block()
+	}
 	if !t.Running() {
-		log.L("Change detected, will start task in %v", t.c.ChangeTimeout)
-		go func() {
-			time.Sleep(t.c.ChangeTimeout)
-			t.Reprocess <- struct{}{}
-		}()
+		log.L(t.prefix+"Change detected, will start task in %v", t.c.ChangeTimeout)
+		go t.reprocessAfter(t.c.ChangeTimeout)
+		return
+	}
+
+	if t.oneshot() {
+		log.L(t.prefix+"Change detected, will cancel the current run in %v", t.c.ChangeTimeout)
+	} else {
+		log.L(t.prefix+"Change detected, will restart task in %v", t.c.ChangeTimeout)
+	}
+	// reloadCheck stops once the task exits, which may happen on its own before the
+	// change timeout has passed.
+	go t.reprocessAfter(t.c.ChangeTimeout)
+	go t.reloadCheck(t.Task)
+}
+
+// Signal sends sig to the running server after the change timeout, without restarting it
+// or blocking proxies. It is ignored if the server is not running, or is being restarted.
+func (t *SM) Signal(sig config.Signal) {
+	if !t.Running() || !t.isLastStep() || t.PendingClose() {
 		return
 	}
 
-	log.L("Change detected, will restart task in %v", t.c.ChangeTimeout)
-	go t.reloadCheck()
+	t.changeSignal = sig
+	if t.signalAt.IsZero() {
+		log.L(t.prefix+"Change detected, will send %v to task in %v", sig, t.c.ChangeTimeout)
+		t.signalAt = time.Now().Add(t.c.ChangeTimeout)
+		go t.reprocessAfter(t.c.ChangeTimeout)
+	}
+}
+
+// Forward sends sig to the running task immediately, and to the previous server if
+// it is still running.
+func (t *SM) Forward(sig config.Signal) {
+	for _, task := range []*Task{t.Task, t.server} {
+		if task != nil && !task.Exited() {
+			t.signal(task, sig)
+		}
+	}
 }
 
-// Close will try interrupt the task, and if it does not close in 500ms, it will kill it.
+// Close will stop the task using the configured stop signals. Hooks that are still
+// running are killed, but the beforeStop and afterStop hooks are waited for.
 func (t *SM) Close() {
-	if !t.Running() {
-		return
+	t.killHooks()
+	defer t.waitHooks()
+	for _, task := range []*Task{t.Task, t.server} {
+		if task != nil && !task.Exited() {
+			t.stopTask(task)
+		}
+		if task != nil {
+			t.stopped(task)
+		}
 	}
+}
 
-	t.Task.Interrupt()
-	select {
-	case <-t.Reprocess:
-		return
-	case <-t.reloadEnded:
-		return
-	case <-time.After(t.c.KillTimeout):
-		t.Task.Kill()
+// reloadDependents reloads all tasks that depend on this task after it restarts.
+func (t *SM) reloadDependents() {
+	for _, d := range t.dependents {
+		if !d.PendingClose() {
+			log.V(t.prefix+"Restarting dependent task %v", d.c.Name)
+			d.Reload("")
+		}
 	}
 }
 
-// reloadCheck is a goroutine that triggers a reprocess till the reload has completed.
-func (t *SM) reloadCheck() {
+// reprocessAfter is a goroutine that triggers a reprocess after the given duration.
+func (t *SM) reprocessAfter(d time.Duration) {
+	time.Sleep(d)
+	t.Reprocess <- struct{}{}
+}
+
+// reloadCheck is a goroutine that triggers a reprocess till the given task has ended.
+func (t *SM) reloadCheck(task *Task) {
 	for {
 		select {
-		case <-t.reloadEnded:
+		case <-task.exited:
 			return
 		case <-time.After(100 * time.Millisecond):
 			t.Reprocess <- struct{}{}
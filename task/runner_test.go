@@ -0,0 +1,272 @@
+// +build !windows
+
+package task
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/prashantv/autobld/config"
+	"github.com/prashantv/autobld/proxy"
+)
+
+// smTimeout is how long the state machine tests wait for a state to be reached.
+const smTimeout = 5 * time.Second
+
+// shellTask returns the configuration for a task that runs each command as a step
+// using sh. The last command is the server.
+func shellTask(cmds ...string) *config.Task {
+	c := &config.Task{
+		ChangeTimeout: 10 * time.Millisecond,
+		StopSignals: []config.StopSignal{
+			{Signal: config.Signal(syscall.SIGTERM), Timeout: time.Second},
+			{Signal: config.Signal(syscall.SIGKILL)},
+		},
+	}
+	for i, cmd := range cmds {
+		c.Steps = append(c.Steps, config.Step{
+			Name:   fmt.Sprintf("step%v", i+1),
+			Action: []string{"sh", "-c", cmd},
+		})
+	}
+	return c
+}
+
+// newTestSM returns a state machine for c, as it is set up by main.
+func newTestSM(c *config.Task) *SM {
+	blockRequests := &sync.WaitGroup{}
+	blockRequests.Add(1)
+	return NewSM(c, blockRequests, proxy.NewBackend(), make(chan struct{}))
+}
+
+// closeTestSM closes the state machine, and keeps reading from its reprocess channel
+// so that goroutines that trigger a reprocess after the test do not block.
+func closeTestSM(sm *SM) {
+	go func() {
+		for range sm.Reprocess {
+		}
+	}()
+	sm.Close()
+}
+
+// runSM executes the state machine till cond returns true, waiting for a reprocess
+// between executions like main's event loop. It returns false if cond is still false
+// after smTimeout.
+func runSM(t *testing.T, sm *SM, cond func() bool) bool {
+	deadline := time.After(smTimeout)
+	for {
+		for rerun := true; rerun; {
+			var err error
+			if rerun, err = sm.Execute(); err != nil {
+				t.Fatalf("Execute failed: %v", err)
+			}
+		}
+		if cond() {
+			return true
+		}
+		select {
+		case <-sm.Reprocess:
+		case <-deadline:
+			return false
+		}
+	}
+}
+
+// readLines returns the lines in the file at path, or nil if it does not exist.
+func readLines(path string) []string {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	return strings.Fields(string(contents))
+}
+
+// stdoutProbe returns a readiness probe that waits for re to match the task's STDOUT.
+func stdoutProbe(re string) *config.Probe {
+	return &config.Probe{
+		Stdout:       re,
+		StdoutRegexp: regexp.MustCompile(re),
+		Timeout:      smTimeout,
+		Interval:     10 * time.Millisecond,
+	}
+}
+
+// tempDir creates a temporary directory for a test, which the caller should remove.
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "autobld-runner")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	return dir
+}
+
+func TestBuildBeforeSwap(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	fail := filepath.Join(dir, "fail")
+	servers := filepath.Join(dir, "servers")
+
+	// The build step fails if the fail file exists, and checks that the previous
+	// server (if any) is still running while it builds.
+	c := shellTask(
+		fmt.Sprintf(`test ! -e %[1]v && { test ! -e %[2]v || kill -0 $(tail -n 1 %[2]v); }`, fail, servers),
+		fmt.Sprintf(`echo $$ >> %v; echo started; exec sleep 60`, servers),
+	)
+	c.BuildBeforeSwap = true
+	c.Ready = stdoutProbe("started")
+	sm := newTestSM(c)
+	defer closeTestSM(sm)
+
+	if !runSM(t, sm, sm.Ready) {
+		t.Fatalf("task is not ready: %v", sm.Status())
+	}
+	first := sm.Task
+
+	if err := ioutil.WriteFile(fail, nil, 0666); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	sm.Reload("")
+	if !runSM(t, sm, func() bool { return sm.failed }) {
+		t.Fatalf("build did not fail: %v", sm.Status())
+	}
+	if sm.server != first || first.Exited() {
+		t.Errorf("previous server was not kept running after the build failed")
+	}
+
+	os.Remove(fail)
+	sm.Reload("")
+	if !runSM(t, sm, func() bool { return sm.Ready() && sm.server == nil }) {
+		t.Fatalf("task is not ready after the build succeeded: %v", sm.Status())
+	}
+	if sm.Task == first || !first.Exited() {
+		t.Errorf("previous server was not replaced after the build succeeded")
+	}
+	if got := readLines(servers); len(got) != 2 {
+		t.Errorf("servers got %v, want 2 servers", got)
+	}
+}
+
+// freePort returns a port that is not in use.
+func freePort(t *testing.T) int {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+// dialProxy connects to the proxy on port, retrying till it is listening.
+func dialProxy(t *testing.T, port int) net.Conn {
+	deadline := time.Now().Add(smTimeout)
+	for {
+		conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%v", port))
+		if err == nil {
+			return conn
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Dial failed: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	tests := []struct {
+		msg          string
+		proxyType    proxy.Type
+		drainTimeout time.Duration
+		// release is how long the request takes, or 0 if it does not finish.
+		release  time.Duration
+		wantWait time.Duration
+	}{
+		{
+			msg:          "waits for HTTP requests",
+			proxyType:    proxy.HTTP,
+			drainTimeout: smTimeout,
+			release:      200 * time.Millisecond,
+			wantWait:     200 * time.Millisecond,
+		},
+		{
+			msg:          "stops after the drain timeout",
+			proxyType:    proxy.HTTP,
+			drainTimeout: 200 * time.Millisecond,
+			wantWait:     200 * time.Millisecond,
+		},
+		{
+			msg:          "does not wait for TCP connections",
+			proxyType:    proxy.TCP,
+			drainTimeout: smTimeout,
+		},
+	}
+
+	for _, tt := range tests {
+		// The server that the proxy forwards to holds every request till it is released.
+		connected := make(chan struct{}, 1)
+		release := make(chan struct{})
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}))
+		server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+			if state == http.StateNew {
+				connected <- struct{}{}
+			}
+		}
+		server.Start()
+
+		c := shellTask("exec sleep 60")
+		c.DrainTimeout = tt.drainTimeout
+		sm := newTestSM(c)
+		pc := proxy.Config{
+			Type:      tt.proxyType,
+			Port:      freePort(t),
+			ForwardTo: server.Listener.Addr().(*net.TCPAddr).Port,
+		}
+		proxy.Start(pc, sm.blockRequests, sm.backend, make(chan error, 1))
+
+		if !runSM(t, sm, sm.Ready) {
+			t.Fatalf("%v: task is not ready: %v", tt.msg, sm.Status())
+		}
+		conn := dialProxy(t, pc.Port)
+		if tt.proxyType == proxy.HTTP {
+			fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+		}
+		select {
+		case <-connected:
+		case <-time.After(smTimeout):
+			t.Fatalf("%v: proxy did not connect to the server", tt.msg)
+		}
+		if tt.release > 0 {
+			time.AfterFunc(tt.release, func() { close(release) })
+		}
+
+		first := sm.Task
+		reloaded := time.Now()
+		sm.Reload("")
+		if !runSM(t, sm, func() bool { return !first.stopSent.IsZero() }) {
+			t.Errorf("%v: task was not stopped: %v", tt.msg, sm.Status())
+		}
+		wait := first.stopSent.Sub(reloaded)
+		if wait < tt.wantWait || wait > tt.wantWait+time.Second {
+			t.Errorf("%v: task was stopped after %v, want %v", tt.msg, wait, tt.wantWait)
+		}
+
+		if tt.release == 0 {
+			close(release)
+		}
+		conn.Close()
+		closeTestSM(sm)
+		server.Close()
+	}
+}
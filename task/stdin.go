@@ -12,11 +12,17 @@ import (
 // To avoid this, we set up a channel to which data is written to from Stdin
 // and a task specific goroutine will use select to read/write, or will notice
 // when the task has ended, and stop reading from Stdin.
+// When keyboard commands are enabled, Stdin must still be read while no task is
+// reading it, so the input for the task is queued instead, and sent by queueStdin.
 
-var stdinChan = make(chan []byte)
+var (
+	stdinChan  = make(chan []byte)
+	stdinQueue = make(chan []byte)
+)
 
 func init() {
 	go stdinLoop()
+	go queueStdin()
 }
 
 func stdinLoop() {
@@ -26,16 +32,56 @@ func stdinLoop() {
 	for {
 		n, err := os.Stdin.Read(bytes)
 		if err != nil {
-			stdinChan <- nil
+			sendStdin(nil)
 			return
 		}
-		stdinChan <- bytes[:n]
+		data := filterCommands(bytes[:n])
+		if len(data) == 0 {
+			// The input only contained keyboard commands.
+			continue
+		}
+		if commandsEnabled() {
+			// The queued data is sent later, so it cannot share the buffer.
+			stdinQueue <- append([]byte(nil), data...)
+			continue
+		}
+		stdinChan <- data
 		// The receiver of bytes will read it, and we do not want to overwrite the buffer
 		// while they are reading it, so we swap buffers.
 		bytes, bytes2 = bytes2, bytes
 	}
 }
 
+// sendStdin sends data to the next task that reads Stdin, through the queue if
+// keyboard commands are enabled.
+func sendStdin(data []byte) {
+	if commandsEnabled() {
+		stdinQueue <- data
+		return
+	}
+	stdinChan <- data
+}
+
+// queueStdin keeps the input sent to stdinQueue till a task reads it from stdinChan,
+// so that stdinLoop never blocks and keyboard commands are always handled.
+func queueStdin() {
+	var queue [][]byte
+	for {
+		var out chan []byte
+		var next []byte
+		if len(queue) > 0 {
+			out = stdinChan
+			next = queue[0]
+		}
+		select {
+		case data := <-stdinQueue:
+			queue = append(queue, data)
+		case out <- next:
+			queue = queue[1:]
+		}
+	}
+}
+
 // copyStdin takes data from os.Stdin sent over stdinChan and writes it to
 // a task's Stdin.
 func copyStdin(stdinPipe io.WriteCloser, closer <-chan struct{}) {
@@ -5,7 +5,11 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/prashantv/autobld/config"
 	"github.com/prashantv/autobld/log"
 )
 
@@ -16,50 +20,255 @@ type Task struct {
 	pgid int
 	// stdinPipe is a pipe to write Stdin to.
 	stdinPipe io.WriteCloser
+
+	cmd *exec.Cmd
+	// exited is closed once the process has exited, after which state is valid.
+	exited chan struct{}
+	state  *os.ProcessState
+	// closers are closed once the process has exited.
+	closers []io.Closer
+	// pty is the master of the task's pseudo-terminal, if it runs under one, and
+	// ptyDone is closed once all of its output has been copied.
+	pty     *os.File
+	ptyDone chan struct{}
+	// group tracks every process started by the task, including any that escape
+	// its process group.
+	group *procGroup
+
+	// beforeStop is the beforeStop hook that the first stop signal is waiting for.
+	beforeStop *hookRun
+	// drainStart is when the task started waiting for proxied requests to finish before it is stopped.
+	drainStart time.Time
+	// stopStep is the index of the last stop signal sent, and stopSent is when it was sent.
+	stopStep int
+	stopSent time.Time
 }
 
-func getOutFile(confFile string, defaultFile *os.File) (*os.File, error) {
-	if confFile == "" {
-		return defaultFile, nil
-	}
-	return os.Create(confFile)
+var (
+	// startMu is held while a process is started, so it is not reaped before it is added to started.
+	startMu sync.Mutex
+	// started are the processes started by New that have not been waited for yet.
+	started = make(map[int]bool)
+)
+
+// Options are the options used to start a task.
+type Options struct {
+	// Dir is the working directory for the task.
+	Dir string
+	// Args is the binary to run, followed by its arguments.
+	Args []string
+	// Env is added to the environment inherited from autobld.
+	Env []string
+	// Stdout and Stderr are where the task's STDOUT and STDERR are written to.
+	Stdout io.Writer
+	Stderr io.Writer
+	// Closers are closed once the task exits, or if it fails to start.
+	Closers []io.Closer
+	// TTY runs the task under a pseudo-terminal. Its output is written to Stdout.
+	TTY bool
 }
 
-// New starts the binary specified in args, and returns a Task for the process.
-func New(baseDir string, outFile string, errFile string, args []string) (*Task, error) {
-	if !log.V("Starting task: %v", args) {
-		log.L("Starting task")
+// ptyCopyTimeout is how long to wait for the remaining output from a pseudo-terminal
+// once the task exits, as other processes may still have it open.
+const ptyCopyTimeout = 100 * time.Millisecond
+
+// nopCloser is used for the pseudo-terminal's stdin, as the master is only
+// closed once the task exits.
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+func closeAll(closers []io.Closer) {
+	for _, c := range closers {
+		c.Close()
 	}
+}
+
+// New starts the binary specified in opts, and returns a Task for the process.
+func New(opts Options) (*Task, error) {
+	args := opts.Args
 	cmd := exec.Command(args[0], args[1:]...)
 
 	// Use a separate process group so we can kill the whole group.
-	cmd.Dir = baseDir
-	cmd.SysProcAttr = getSysProcAttrs()
-	var err error
-	if cmd.Stdout, err = getOutFile(outFile, os.Stdout); err != nil {
-		return nil, err
+	cmd.Dir = opts.Dir
+	if len(opts.Env) > 0 {
+		cmd.Env = append(os.Environ(), opts.Env...)
 	}
-	if cmd.Stderr, err = getOutFile(errFile, os.Stderr); err != nil {
-		return nil, err
-	}
-	stdinPipe, err := cmd.StdinPipe()
-	if err != nil {
-		return nil, err
+	cmd.SysProcAttr = getSysProcAttrs(opts.TTY)
+	group := newProcGroup(cmd)
+
+	var stdinPipe io.WriteCloser
+	var pty, ptySlave *os.File
+	if opts.TTY {
+		var err error
+		if pty, ptySlave, err = openPTY(); err != nil {
+			closeAll(opts.Closers)
+			return nil, fmt.Errorf("error opening pty: %v", err)
+		}
+		cmd.Stdin = ptySlave
+		cmd.Stdout = ptySlave
+		cmd.Stderr = ptySlave
+		stdinPipe = nopCloser{pty}
+	} else {
+		cmd.Stdout = opts.Stdout
+		cmd.Stderr = opts.Stderr
+		var err error
+		if stdinPipe, err = cmd.StdinPipe(); err != nil {
+			closeAll(opts.Closers)
+			return nil, err
+		}
 	}
 
-	if err := cmd.Start(); err != nil {
+	startMu.Lock()
+	err := cmd.Start()
+	if err == nil {
+		started[cmd.Process.Pid] = true
+	}
+	startMu.Unlock()
+	if err == nil {
+		group.start(cmd.Process.Pid)
+	} else {
+		group.failed()
+	}
+	if ptySlave != nil {
+		// The task has its own copy of the slave.
+		ptySlave.Close()
+	}
+	if err != nil {
+		if pty != nil {
+			pty.Close()
+		}
+		closeAll(opts.Closers)
 		return nil, fmt.Errorf("error starting command: %v", err)
 	}
 	pgid, err := getPgID(cmd)
 	if err != nil {
 		// If we cannot get the pgid, kill the process and return an error.
 		cmd.Process.Kill()
+		cmd.Wait()
+		forget(cmd.Process.Pid)
+		if pty != nil {
+			pty.Close()
+		}
+		closeAll(opts.Closers)
 		return nil, err
 	}
 
-	return &Task{
+	t := &Task{
 		process:   cmd.Process,
 		pgid:      pgid,
 		stdinPipe: stdinPipe,
-	}, nil
+		cmd:       cmd,
+		exited:    make(chan struct{}),
+		closers:   opts.Closers,
+		pty:       pty,
+		group:     group,
+	}
+	if pty != nil {
+		t.ptyDone = make(chan struct{})
+		go func() {
+			io.Copy(opts.Stdout, pty)
+			close(t.ptyDone)
+		}()
+		go forwardResize(pty, t.exited)
+	}
+	go t.wait()
+	return t, nil
+}
+
+func (t *Task) wait() {
+	t.cmd.Wait()
+	t.group.exited()
+	forget(t.process.Pid)
+	t.state = t.cmd.ProcessState
+	if t.pty != nil {
+		select {
+		case <-t.ptyDone:
+		case <-time.After(ptyCopyTimeout):
+		}
+		t.pty.Close()
+	}
+	t.group.close()
+	closeAll(t.closers)
+	close(t.exited)
+}
+
+// forget removes pid from started once it has been waited for.
+func forget(pid int) {
+	startMu.Lock()
+	defer startMu.Unlock()
+	delete(started, pid)
+}
+
+// Wait blocks till the task's process has exited.
+func (t *Task) Wait() {
+	<-t.exited
+}
+
+// Stop sends each of the stop signals to the task till it exits, waiting for each
+// signal's timeout before sending the next one. It returns once the task has exited,
+// or the timeout for the last signal has passed.
+func (t *Task) Stop(stopSignals []config.StopSignal) {
+	for _, s := range stopSignals {
+		t.stopSent = time.Now()
+		if err := t.Signal(syscall.Signal(s.Signal)); err != nil {
+			log.V("Failed to send %v to task: %v", s.Signal, err)
+		}
+		select {
+		case <-t.exited:
+			return
+		case <-time.After(s.Timeout):
+		}
+	}
+}
+
+// Survivors returns descriptions of the processes started by the task that are still
+// running after it exited, e.g. "1234 (server)".
+func (t *Task) Survivors() []string {
+	return t.group.survivors()
+}
+
+// KillSurvivors kills any processes started by the task that are still running after
+// it exited, and returns descriptions of them.
+func (t *Task) KillSurvivors() []string {
+	killed := t.group.killSurvivors()
+	if len(killed) > 0 {
+		t.group.close()
+	}
+	return killed
+}
+
+// Exited returns whether the task's process has exited.
+func (t *Task) Exited() bool {
+	select {
+	case <-t.exited:
+		return true
+	default:
+		return false
+	}
+}
+
+// Success returns whether the task exited with a zero exit code.
+// It should only be called once the task has exited.
+func (t *Task) Success() bool {
+	return t.state != nil && t.state.Success()
+}
+
+// State returns a description of how the task exited.
+func (t *Task) State() string {
+	if t.state == nil {
+		return "unknown state"
+	}
+	return exitStatus(t.state)
+}
+
+// ExitCode returns the exit code of the task, or -1 if it was killed by a signal.
+// It should only be called once the task has exited.
+func (t *Task) ExitCode() int {
+	if t.state == nil {
+		return -1
+	}
+	return t.state.ExitCode()
 }
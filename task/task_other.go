@@ -3,13 +3,21 @@
 package task
 
 import (
+	"errors"
+	"fmt"
+	"os"
 	"os/exec"
 	"syscall"
 
 	"github.com/prashantv/autobld/log"
 )
 
-func getSysProcAttrs() *syscall.SysProcAttr {
+func getSysProcAttrs(tty bool) *syscall.SysProcAttr {
+	if tty {
+		// The task is a session leader with the pty as its controlling terminal,
+		// which also makes it the leader of a new process group.
+		return &syscall.SysProcAttr{Setsid: true, Setctty: true}
+	}
 	return &syscall.SysProcAttr{Setpgid: true}
 }
 
@@ -20,11 +28,36 @@ func getPgID(cmd *exec.Cmd) (int, error) {
 // Interrupt sends the same signal as a Ctrl-C to the task.
 func (t *Task) Interrupt() error {
 	log.VV("Requested Ctrl-C on task")
-	return syscall.Kill(-t.pgid, syscall.SIGINT)
+	return t.Signal(syscall.SIGINT)
 }
 
 // Kill sends a KILL signal to the task.
 func (t *Task) Kill() error {
 	log.V("Kill task")
-	return syscall.Kill(-t.pgid, syscall.SIGKILL)
+	return t.Signal(syscall.SIGKILL)
+}
+
+// Signal sends the given signal to the task's process group, and to any processes
+// started by the task that have left the process group.
+func (t *Task) Signal(sig syscall.Signal) error {
+	log.VV("Sending signal %v to task", sig)
+	err := syscall.Kill(-t.pgid, sig)
+	if n := t.group.signal(sig, t.pgid); n > 0 && err == syscall.ESRCH {
+		// The process group has exited, but other processes started by the task have not.
+		err = nil
+	}
+	return err
+}
+
+// exitStatus returns a description of the exit code or signal that ended the process.
+func exitStatus(state *os.ProcessState) string {
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return fmt.Sprintf("killed by signal %d (%v)", ws.Signal(), ws.Signal())
+	}
+	return fmt.Sprintf("exit code %v", state.ExitCode())
+}
+
+// isAddrInUse returns whether err is because the address is already in use.
+func isAddrInUse(err error) bool {
+	return errors.Is(err, syscall.EADDRINUSE)
 }
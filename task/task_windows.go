@@ -1,7 +1,9 @@
 package task
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
 	"syscall"
 	"unsafe"
@@ -14,7 +16,7 @@ var (
 	procGenerateConsoleCtrlEvent = modkernel32.NewProc("GenerateConsoleCtrlEvent")
 )
 
-func getSysProcAttrs() *syscall.SysProcAttr {
+func getSysProcAttrs(tty bool) *syscall.SysProcAttr {
 	return &syscall.SysProcAttr{
 		CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP,
 	}
@@ -24,6 +26,11 @@ func getPgID(cmd *exec.Cmd) (int, error) {
 	return cmd.Process.Pid, nil
 }
 
+// exitStatus returns a description of the exit code of the process.
+func exitStatus(state *os.ProcessState) string {
+	return fmt.Sprintf("exit code %v", state.ExitCode())
+}
+
 // Interrupt sends Ctrl-Break to the task's process group.
 func (t *Task) Interrupt() error {
 	log.VV("Requested Ctrl-Break on task")
@@ -53,6 +60,18 @@ func (t *Task) Kill() error {
 	return nil
 }
 
+// Signal sends the given signal to the task. Only SIGINT (sent as Ctrl-Break)
+// and SIGKILL are supported on Windows.
+func (t *Task) Signal(sig syscall.Signal) error {
+	switch sig {
+	case syscall.SIGINT:
+		return t.Interrupt()
+	case syscall.SIGKILL:
+		return t.Kill()
+	}
+	return fmt.Errorf("signal %v is not supported on Windows", sig)
+}
+
 // killChildProcesses will kill pid, then recurse through all children.
 // It does not return on error, but continues and returns all encountered errors.
 func killChildProcesses(parentMap map[uint32][]uint32, pid uint32) []error {
@@ -114,3 +133,11 @@ func loadProcessMap() (map[uint32][]uint32, error) {
 		}
 	}
 }
+
+// wsaeAddrInUse is the Winsock error returned when the address is already in use.
+const wsaeAddrInUse = syscall.Errno(10048)
+
+// isAddrInUse returns whether err is because the address is already in use.
+func isAddrInUse(err error) bool {
+	return errors.Is(err, wsaeAddrInUse)
+}
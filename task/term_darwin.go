@@ -0,0 +1,9 @@
+package task
+
+import "syscall"
+
+// ioctl requests to get and set a terminal's attributes.
+const (
+	tcgets = syscall.TIOCGETA
+	tcsets = syscall.TIOCSETA
+)
@@ -0,0 +1,11 @@
+// +build !linux,!darwin
+
+package task
+
+import "os"
+
+// setCbreak is not supported on this platform, so keyboard commands are only
+// handled once Enter is pressed.
+func setCbreak(f *os.File) func() {
+	return func() {}
+}
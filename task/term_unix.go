@@ -0,0 +1,64 @@
+// +build linux darwin
+
+package task
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+
+	"github.com/prashantv/autobld/log"
+)
+
+func ioctl(f *os.File, req uint, arg unsafe.Pointer) error {
+	// Use SyscallConn rather than Fd, as Fd sets the file to blocking mode,
+	// which would stop Close from interrupting a blocked Read.
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var errno syscall.Errno
+	if err := rc.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, uintptr(req), uintptr(arg))
+	}); err != nil {
+		return err
+	}
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// setTermios applies update to the attributes of the terminal f, and returns a function
+// that restores them. If f is not a terminal, it is left as-is.
+func setTermios(f *os.File, update func(*syscall.Termios)) (func(), error) {
+	var orig syscall.Termios
+	if err := ioctl(f, tcgets, unsafe.Pointer(&orig)); err != nil {
+		// f is not a terminal.
+		return func() {}, nil
+	}
+
+	termios := orig
+	update(&termios)
+	if err := ioctl(f, tcsets, unsafe.Pointer(&termios)); err != nil {
+		return func() {}, err
+	}
+	return func() {
+		ioctl(f, tcsets, unsafe.Pointer(&orig))
+	}, nil
+}
+
+// setCbreak disables line buffering for the terminal f, so that keyboard commands are
+// handled as soon as they are typed. Echo and signals such as Ctrl-C are unaffected.
+// It returns a function that restores the terminal.
+func setCbreak(f *os.File) func() {
+	restore, err := setTermios(f, func(termios *syscall.Termios) {
+		termios.Lflag &^= syscall.ICANON
+		termios.Cc[syscall.VMIN] = 1
+		termios.Cc[syscall.VTIME] = 0
+	})
+	if err != nil {
+		log.V("Failed to disable line buffering, commands are handled after Enter: %v", err)
+	}
+	return restore
+}